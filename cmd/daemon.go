@@ -0,0 +1,182 @@
+package main
+
+import (
+	"backup-to-minio/internal/api"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/runner"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+// daemonCommand выполняет немедленные бэкапы и запускает планировщик для остальных
+func daemonCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	listen := fs.String("listen", os.Getenv("API_LISTEN"), "address for the HTTP control API, e.g. :8080 (disabled if empty)")
+	healthListen := fs.String("health-listen", os.Getenv("HEALTH_LISTEN"), "address for the probe endpoints only, served without a token, e.g. :8081 (disabled if empty)")
+	_ = fs.Parse(args)
+
+	cfg, err := setup(opts)
+	if err != nil {
+		return err
+	}
+
+	// Получение имени бакета
+	bucket, err := bucketName()
+	if err != nil {
+		return err
+	}
+
+	// Запуск бэкапов с учетом политики пересечений и лимитов параллельности
+	backupRunner := runner.New(cfg, bucket)
+
+	// Инициализация планировщика
+	scheduler := gocron.NewScheduler(time.UTC)
+	hasScheduledJobs := false
+
+	// Контекст выполняющихся бэкапов; отменяется по истечении времени ожидания при остановке
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Обработка CTRL+C для graceful shutdown
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Регистрация запланированных бэкапов
+	var immediate []config.ConfigBackup
+	for i := range cfg.Backups {
+		item := cfg.Backups[i]
+
+		if item.Schedule == "" {
+			immediate = append(immediate, item)
+			continue
+		}
+
+		// Запланированное выполнение
+		// Результат запуска записывается в лог самим runner
+		_, err := scheduler.Cron(item.Schedule).Tag(item.Name).Do(func(b config.ConfigBackup) {
+			_ = backupRunner.Run(ctx, b, runner.TriggerSchedule)
+		}, item)
+
+		if err != nil {
+			slog.Error("failed to schedule backup", "backup", item.Name, "error", err)
+			continue
+		}
+		hasScheduledJobs = true
+	}
+
+	// Планировщик запускается до немедленных бэкапов, чтобы долгие бэкапы не сдвигали расписание
+	scheduler.StartAsync()
+
+	// HTTP API управления и пробы запускаются до немедленных бэкапов, чтобы их можно было отслеживать
+	token := os.Getenv("API_TOKEN")
+	if *listen != "" && token == "" {
+		scheduler.Stop()
+		return fmt.Errorf("API_TOKEN environment variable is required when the HTTP API is enabled")
+	}
+	apiHandler := api.New(ctx, cfg, bucket, backupRunner, scheduler, token)
+
+	var servers []*http.Server
+	if *listen != "" {
+		servers = append(servers, serveHTTP("HTTP API", *listen, apiHandler.Handler()))
+	}
+	// Пробы на отдельном адресе не требуют токена и не открывают API управления
+	if *healthListen != "" {
+		servers = append(servers, serveHTTP("health probes", *healthListen, apiHandler.ProbeHandler()))
+	}
+
+	stopping := make(chan struct{})
+	shutdownDone := make(chan struct{})
+	go func() {
+		<-stopChan
+		close(stopping)
+
+		// API останавливается первым, чтобы во время ожидания не появлялись новые запуски
+		for _, server := range servers {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				slog.Error("HTTP server shutdown failed", "addr", server.Addr, "error", err)
+			}
+			shutdownCancel()
+		}
+
+		slog.Info("shutting down scheduler")
+		shutdown(scheduler, backupRunner, cfg.ShutdownGrace, cancel)
+		slog.Info("scheduler stopped")
+		close(shutdownDone)
+	}()
+
+	// Немедленное выполнение; после сигнала остановки новые бэкапы не запускаются
+	for _, item := range immediate {
+		select {
+		case <-stopping:
+			slog.Info("skipping immediate backup: shutting down", "backup", item.Name)
+			continue
+		default:
+		}
+		_ = backupRunner.Run(ctx, item, runner.TriggerImmediate)
+	}
+
+	if hasScheduledJobs || len(servers) > 0 {
+		slog.Info("scheduler started, press CTRL+C to exit")
+	} else {
+		slog.Info("no scheduled backups found, exiting")
+		select {
+		case <-stopping:
+			<-shutdownDone
+		default:
+			scheduler.Stop()
+		}
+		return nil
+	}
+
+	// Ожидание сигнала завершения и остановки выполняющихся бэкапов
+	<-shutdownDone
+	return nil
+}
+
+// serveHTTP запускает HTTP-сервер в фоне
+func serveHTTP(name, addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info(name+" listening", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(name+" failed", "error", err)
+		}
+	}()
+	return server
+}
+
+// shutdown останавливает планировщик и ждет завершения выполняющихся бэкапов.
+// Если они не завершились за grace, контекст отменяется: дочерние процессы
+// завершаются, а временные файлы и незавершенные загрузки удаляются.
+func shutdown(scheduler *gocron.Scheduler, backupRunner *runner.Runner, grace time.Duration, cancel context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		scheduler.Stop()
+		backupRunner.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		slog.Warn("running backups did not finish within grace period, cancelling", "grace", grace.String())
+		cancel()
+		<-done
+	}
+}
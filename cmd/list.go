@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// listCommand выводит список настроенных бэкапов с расписанием и временем следующего запуска
+func listCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	_ = fs.Parse(args)
+
+	cfg, err := setup(opts)
+	if err != nil {
+		return err
+	}
+
+	// Планировщик работает в UTC, поэтому и время следующего запуска считаем в UTC
+	now := time.Now().UTC()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSCHEDULE\tNEXT RUN")
+	for _, item := range cfg.Backups {
+		schedule, nextRun := "-", "-"
+		if item.Schedule != "" {
+			schedule = item.Schedule
+			nextRun = "invalid schedule"
+			if sched, err := cron.ParseStandard(item.Schedule); err == nil {
+				nextRun = sched.Next(now).Format(time.RFC3339)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", item.Name, item.Type, schedule, nextRun)
+	}
+	return w.Flush()
+}
@@ -1,82 +1,138 @@
 package main
 
 import (
-	"backup-to-minio/internal/backup"
 	"backup-to-minio/internal/config"
-	"log"
+	"backup-to-minio/internal/logging"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	"github.com/go-co-op/gocron"
 	"github.com/joho/godotenv"
 )
 
+// options содержит общие флаги командной строки
+type options struct {
+	configPath string // Путь к файлу конфигурации
+	envFile    string // Путь к .env файлу (если не задан, используется .env при наличии)
+	logFormat  string // Формат логов: text или json (по умолчанию LOG_FORMAT или text)
+	logLevel   string // Уровень логов (по умолчанию LOG_LEVEL или info)
+}
+
+const usage = `Usage: backup-tool [--config path] [--env-file path] [--log-format text|json] [--log-level level] <command> [args]
+
+Commands:
+  daemon             Run immediate backups and start the scheduler (default)
+  run <name...>      Run the named backups now and exit
+  run --all          Run all configured backups now and exit
+  list               List configured backups with schedule and next run time
+  snapshots          List backup objects stored in the bucket
+  restore-mysql <binlog-backup> --database db [--until time]
+                     Restore a MySQL database to a point in time
+  archive-wal <backup> <path> <name>
+                     Upload a PostgreSQL WAL file (archive_command)
+  restore-wal <backup> <name> <path>
+                     Download a PostgreSQL WAL file (restore_command)
+  prune-wal <backup> Delete WAL files older than the oldest base backup
+`
+
 func main() {
-	// Загрузка переменных окружения
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using only system environment variables")
-	}
+	opts := &options{}
+	fs := flag.NewFlagSet("backup-tool", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	addCommonFlags(fs, opts)
+	_ = fs.Parse(os.Args[1:])
 
-	// Загрузка конфигурации
-	cfg, err := config.LoadConfig("config.yml")
-	if err != nil {
-		log.Fatalf("Config loading failed: %v", err)
+	command, args := "daemon", fs.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	// Получение имени бакета
-	bucketName := os.Getenv("MINIO_BUCKET_NAME")
-	if bucketName == "" {
-		log.Fatal("MINIO_BUCKET_NAME environment variable is required")
+	var err error
+	switch command {
+	case "daemon":
+		err = daemonCommand(opts, args)
+	case "run":
+		err = runCommand(opts, args)
+	case "list":
+		err = listCommand(opts, args)
+	case "snapshots":
+		err = snapshotsCommand(opts, args)
+	case "restore-mysql":
+		err = restoreMySQLCommand(opts, args)
+	case "archive-wal":
+		err = archiveWALCommand(opts, args)
+	case "restore-wal":
+		err = restoreWALCommand(opts, args)
+	case "prune-wal":
+		err = pruneWALCommand(opts, args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", command, usage)
+		os.Exit(2)
 	}
 
-	// Инициализация планировщика
-	scheduler := gocron.NewScheduler(time.UTC)
-	hasScheduledJobs := false
-
-	// Обработка CTRL+C для graceful shutdown
-	stopChan := make(chan os.Signal, 1)
-	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Обработка всех бэкапов
-	for i := range cfg.Backups {
-		item := cfg.Backups[i]
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
 
-		if item.Schedule != "" {
-			// Запланированное выполнение
-			_, err := scheduler.Cron(item.Schedule).Do(func(c *config.BackupConfig, b config.ConfigBackup, bucket string) {
-				log.Printf("Starting scheduled backup: %s", b.Name)
-				if err := backup.ProcessBackup(c, b, bucket); err != nil {
-					log.Printf("Backup %s failed: %v", b.Name, err)
-				}
-			}, cfg, item, bucketName)
+// addCommonFlags регистрирует общие флаги, чтобы их можно было указывать и после подкоманды
+func addCommonFlags(fs *flag.FlagSet, opts *options) {
+	if opts.configPath == "" {
+		opts.configPath = "config.yml"
+	}
+	fs.StringVar(&opts.configPath, "config", opts.configPath, "path to the backup configuration file")
+	fs.StringVar(&opts.envFile, "env-file", opts.envFile, "path to the environment file (default: .env if present)")
+	fs.StringVar(&opts.logFormat, "log-format", opts.logFormat, "log format: text or json (default: $LOG_FORMAT or text)")
+	fs.StringVar(&opts.logLevel, "log-level", opts.logLevel, "log level: debug, info, warn or error (default: $LOG_LEVEL or info)")
+}
 
-			if err != nil {
-				log.Printf("Failed to schedule %s: %v", item.Name, err)
-				continue
-			}
-			hasScheduledJobs = true
-		} else {
-			// Немедленное выполнение
-			log.Printf("Starting immediate backup: %s", item.Name)
-			if err := backup.ProcessBackup(cfg, item, bucketName); err != nil {
-				log.Printf("Backup %s failed: %v", item.Name, err)
-			}
+// setup загружает переменные окружения, настраивает логирование и загружает конфигурацию
+func setup(opts *options) (*config.BackupConfig, error) {
+	// Загрузка переменных окружения
+	envMissing := false
+	if opts.envFile != "" {
+		if err := godotenv.Load(opts.envFile); err != nil {
+			return nil, fmt.Errorf("failed to load env file %s: %w", opts.envFile, err)
 		}
+	} else if err := godotenv.Load(); err != nil {
+		envMissing = true
 	}
 
-	// Запуск планировщика если есть задания
-	if hasScheduledJobs {
-		scheduler.StartAsync()
-		log.Println("Scheduler started. Press CTRL+C to exit")
+	// Настройка логирования; переменные окружения могут прийти из .env
+	logFormat, logLevel := opts.logFormat, opts.logLevel
+	if logFormat == "" {
+		logFormat = os.Getenv("LOG_FORMAT")
+	}
+	if logLevel == "" {
+		logLevel = os.Getenv("LOG_LEVEL")
+	}
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	if err := logging.Setup(os.Stderr, logFormat, logLevel); err != nil {
+		return nil, err
+	}
+	if envMissing {
+		slog.Info("no .env file found, using only system environment variables")
+	}
+
+	// Загрузка конфигурации
+	cfg, err := config.LoadConfig(opts.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("config loading failed: %w", err)
+	}
+	return cfg, nil
+}
 
-		// Ожидание сигнала завершения
-		<-stopChan
-		log.Println("Shutting down scheduler...")
-		scheduler.Stop()
-		log.Println("Scheduler stopped")
-	} else {
-		log.Println("No scheduled backups found. Exiting")
+// bucketName возвращает имя бакета из окружения
+func bucketName() (string, error) {
+	bucket := os.Getenv("MINIO_BUCKET_NAME")
+	if bucket == "" {
+		return "", fmt.Errorf("MINIO_BUCKET_NAME environment variable is required")
 	}
+	return bucket, nil
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"backup-to-minio/internal/backup"
+	"context"
+	"flag"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// restoreMySQLCommand восстанавливает базу MySQL на момент времени из полного дампа и архивированных binlog-файлов
+func restoreMySQLCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("restore-mysql", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	database := fs.String("database", "", "database to restore")
+	until := fs.String("until", "", "replay binlogs up to this time (RFC3339, default: now)")
+	target := fs.String("target", "", "MySQL server to restore into (default: source of the base backup)")
+	dryRun := fs.Bool("dry-run", false, "only print the dump and binlog files that would be used")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("restore-mysql: specify exactly one mysql-binlog backup name")
+	}
+
+	untilTime := time.Now().UTC()
+	if *until != "" {
+		parsed, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("restore-mysql: invalid --until: %w", err)
+		}
+		untilTime = parsed.UTC()
+	}
+
+	cfg, err := setup(opts)
+	if err != nil {
+		return err
+	}
+
+	item, ok := cfg.Backup(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("backup not found in config: %s", fs.Arg(0))
+	}
+
+	bucket, err := bucketName()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return backup.RestoreMySQL(ctx, cfg, bucket, item, backup.MySQLRestoreOptions{
+		Database: *database,
+		Until:    untilTime,
+		Target:   *target,
+		DryRun:   *dryRun,
+	})
+}
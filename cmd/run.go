@@ -0,0 +1,81 @@
+package main
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/runner"
+	"context"
+	"flag"
+	"fmt"
+	"os/signal"
+	"syscall"
+)
+
+// runCommand немедленно выполняет указанные бэкапы, включая запланированные, и завершается
+func runCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	all := fs.Bool("all", false, "run all configured backups")
+	_ = fs.Parse(args)
+
+	if !*all && fs.NArg() == 0 {
+		return fmt.Errorf("run: specify backup names or --all")
+	}
+	if *all && fs.NArg() > 0 {
+		return fmt.Errorf("run: --all cannot be combined with backup names")
+	}
+
+	cfg, err := setup(opts)
+	if err != nil {
+		return err
+	}
+
+	items, err := selectBackups(cfg, fs.Args(), *all)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := bucketName()
+	if err != nil {
+		return err
+	}
+
+	// Сигнал завершения прерывает выполняющиеся бэкапы
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	backupRunner := runner.New(cfg, bucket)
+	failed := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := backupRunner.Run(ctx, item, runner.TriggerManual); err != nil {
+			failed++
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("interrupted")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed", failed, len(items))
+	}
+	return nil
+}
+
+// selectBackups возвращает бэкапы по именам в указанном порядке или все бэкапы конфигурации
+func selectBackups(cfg *config.BackupConfig, names []string, all bool) ([]config.ConfigBackup, error) {
+	if all {
+		return cfg.Backups, nil
+	}
+
+	items := make([]config.ConfigBackup, 0, len(names))
+	for _, name := range names {
+		item, ok := cfg.Backup(name)
+		if !ok {
+			return nil, fmt.Errorf("backup not found in config: %s", name)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/minio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Суффиксы вспомогательных объектов, сопровождающих архив
+var (
+	manifestSuffixes = []string{".manifest.json", ".manifest"}
+	checksumSuffixes = []string{".sha256", ".sha256sum", ".md5"}
+)
+
+// runIndexDir - каталог индексов запусков, которые записывает хранение по retention
+const runIndexDir = "/.runs/"
+
+// timestampPattern соответствует временной метке в именах архивов
+var timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z`)
+
+// snapshot описывает один архив резервной копии в бакете
+type snapshot struct {
+	Backup       string    `json:"backup"`
+	Key          string    `json:"key"`
+	Timestamp    time.Time `json:"timestamp"`
+	Size         int64     `json:"size"`
+	StorageClass string    `json:"storage_class"`
+	AgeSeconds   int64     `json:"age_seconds"`
+	Manifest     bool      `json:"manifest"`
+	Checksum     bool      `json:"checksum"`
+}
+
+// snapshotsCommand выводит архивы резервных копий, сохраненные в бакете
+func snapshotsCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("snapshots", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	names := fs.String("backup", "", "comma-separated backup names to show (default: all)")
+	since := fs.String("since", "", "show snapshots taken at or after this date (YYYY-MM-DD or RFC3339)")
+	until := fs.String("until", "", "show snapshots taken before this date (YYYY-MM-DD or RFC3339)")
+	format := fs.String("format", "table", "output format: table or json")
+	_ = fs.Parse(args)
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("snapshots: unsupported format: %s", *format)
+	}
+
+	sinceTime, err := parseDate(*since)
+	if err != nil {
+		return fmt.Errorf("snapshots: invalid --since: %w", err)
+	}
+	untilTime, err := parseDate(*until)
+	if err != nil {
+		return fmt.Errorf("snapshots: invalid --until: %w", err)
+	}
+
+	cfg, err := setup(opts)
+	if err != nil {
+		return err
+	}
+
+	var items []config.ConfigBackup
+	if *names == "" {
+		items = cfg.Backups
+	} else if items, err = selectBackups(cfg, strings.Split(*names, ","), false); err != nil {
+		return err
+	}
+
+	bucket, err := bucketName()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	snapshots := []snapshot{}
+	for _, item := range items {
+		objects, err := minio.ListObjects(ctx, bucket, minio.ObjectPrefix(cfg.Project, item.ObjectPath()))
+		if err != nil {
+			return fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		for _, s := range collectSnapshots(item.Name, objects) {
+			if !sinceTime.IsZero() && s.Timestamp.Before(sinceTime) {
+				continue
+			}
+			if !untilTime.IsZero() && !s.Timestamp.Before(untilTime) {
+				continue
+			}
+			s.AgeSeconds = int64(now.Sub(s.Timestamp).Seconds())
+			snapshots = append(snapshots, s)
+		}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshots)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BACKUP\tOBJECT\tTIMESTAMP\tSIZE\tCLASS\tAGE\tMANIFEST\tCHECKSUM")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Backup,
+			s.Key,
+			s.Timestamp.Format(time.RFC3339),
+			humanize.IBytes(uint64(s.Size)),
+			s.StorageClass,
+			(time.Duration(s.AgeSeconds) * time.Second).String(),
+			yesNo(s.Manifest),
+			yesNo(s.Checksum),
+		)
+	}
+	return w.Flush()
+}
+
+// collectSnapshots группирует объекты бэкапа: архивы и сопровождающие их манифесты и контрольные суммы
+func collectSnapshots(backupName string, objects []minio.ObjectInfo) []snapshot {
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keys[object.Key] = true
+	}
+
+	var snapshots []snapshot
+	for _, object := range objects {
+		if hasAnySuffix(object.Key, manifestSuffixes) || hasAnySuffix(object.Key, checksumSuffixes) || strings.Contains(object.Key, runIndexDir) {
+			continue
+		}
+
+		timestamp := object.LastModified.UTC()
+		if match := timestampPattern.FindString(path.Base(object.Key)); match != "" {
+			if parsed, err := time.Parse("2006-01-02T15-04-05Z", match); err == nil {
+				timestamp = parsed
+			}
+		}
+
+		snapshots = append(snapshots, snapshot{
+			Backup:       backupName,
+			Key:          object.Key,
+			Timestamp:    timestamp,
+			Size:         object.Size,
+			StorageClass: object.StorageClass,
+			Manifest:     hasSidecar(keys, object.Key, manifestSuffixes),
+			Checksum:     hasSidecar(keys, object.Key, checksumSuffixes),
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	return snapshots
+}
+
+// hasSidecar проверяет наличие вспомогательного объекта рядом с архивом
+func hasSidecar(keys map[string]bool, key string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if keys[key+suffix] {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnySuffix проверяет, оканчивается ли строка одним из суффиксов
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDate разбирает дату в формате YYYY-MM-DD или RFC3339
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// yesNo форматирует флаг для табличного вывода
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
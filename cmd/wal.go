@@ -0,0 +1,108 @@
+package main
+
+import (
+	"backup-to-minio/internal/backup"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/minio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// archiveWALCommand загружает WAL-сегмент в бакет; используется в archive_command:
+//
+//	archive_command = 'backup-tool --config /etc/backup/config.yml archive-wal pg-main %p %f'
+func archiveWALCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("archive-wal", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		return fmt.Errorf("archive-wal: usage: archive-wal <backup> <path> <name>")
+	}
+
+	cfg, item, bucket, err := walSetup(opts, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return backup.ArchiveWAL(ctx, cfg, item, bucket, fs.Arg(1), fs.Arg(2))
+}
+
+// restoreWALCommand скачивает WAL-сегмент из бакета; используется в restore_command:
+//
+//	restore_command = 'backup-tool --config /etc/backup/config.yml restore-wal pg-main %f %p'
+func restoreWALCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("restore-wal", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		return fmt.Errorf("restore-wal: usage: restore-wal <backup> <name> <path>")
+	}
+
+	cfg, item, bucket, err := walSetup(opts, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err = backup.RestoreWAL(ctx, cfg, item, bucket, fs.Arg(1), fs.Arg(2))
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		// PostgreSQL запрашивает и отсутствующие файлы (например, .history); это не ошибка
+		slog.Info("WAL file not found in archive", "wal", fs.Arg(1))
+		os.Exit(1)
+	}
+	return err
+}
+
+// pruneWALCommand удаляет WAL-сегменты старше самого старого базового бэкапа в бакете
+func pruneWALCommand(opts *options, args []string) error {
+	fs := flag.NewFlagSet("prune-wal", flag.ExitOnError)
+	addCommonFlags(fs, opts)
+	dryRun := fs.Bool("dry-run", false, "only print what would be deleted")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("prune-wal: specify exactly one postgres backup name")
+	}
+
+	cfg, item, bucket, err := walSetup(opts, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return backup.PruneWAL(ctx, cfg, item, bucket, *dryRun)
+}
+
+// walSetup загружает конфигурацию и находит бэкап postgres, к которому относится архив WAL
+func walSetup(opts *options, name string) (*config.BackupConfig, config.ConfigBackup, string, error) {
+	cfg, err := setup(opts)
+	if err != nil {
+		return nil, config.ConfigBackup{}, "", err
+	}
+
+	item, ok := cfg.Backup(name)
+	if !ok {
+		return nil, config.ConfigBackup{}, "", fmt.Errorf("backup not found in config: %s", name)
+	}
+
+	bucket, err := bucketName()
+	if err != nil {
+		return nil, config.ConfigBackup{}, "", err
+	}
+	return cfg, item, bucket, nil
+}
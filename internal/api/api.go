@@ -0,0 +1,187 @@
+package api
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/runner"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+// JobInfo описывает настроенное задание резервного копирования
+type JobInfo struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Schedule string          `json:"schedule,omitempty"`
+	NextRun  *time.Time      `json:"next_run,omitempty"`
+	Running  bool            `json:"running"`
+	Skipped  int             `json:"skipped"`
+	LastRun  *runner.RunInfo `json:"last_run,omitempty"`
+}
+
+// Server предоставляет HTTP API для просмотра и запуска резервных копий
+type Server struct {
+	ctx       context.Context // Контекст запусков, отменяется при остановке
+	cfg       *config.BackupConfig
+	bucket    string
+	runner    *runner.Runner
+	scheduler *gocron.Scheduler
+	token     string // Токен для аутентификации (Authorization: Bearer <token>); не нужен, если используются только пробы
+
+	mu     sync.Mutex
+	stored map[string]time.Time // Время последних объектов в бакете, найденных после старта
+}
+
+// New создает сервер API. Запуски, инициированные через API, используют контекст ctx.
+func New(ctx context.Context, cfg *config.BackupConfig, bucketName string, backupRunner *runner.Runner, scheduler *gocron.Scheduler, token string) *Server {
+	return &Server{
+		ctx:       ctx,
+		cfg:       cfg,
+		bucket:    bucketName,
+		runner:    backupRunner,
+		scheduler: scheduler,
+		token:     token,
+		stored:    make(map[string]time.Time),
+	}
+}
+
+// Handler возвращает HTTP-обработчик API вместе с пробами
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerProbes(mux)
+
+	mux.HandleFunc("GET /api/jobs", s.auth(s.listJobs))
+	mux.HandleFunc("POST /api/jobs/{name}/run", s.auth(s.runJob))
+	mux.HandleFunc("GET /api/runs", s.auth(s.listRuns))
+	mux.HandleFunc("GET /api/runs/{id}", s.auth(s.getRun))
+	mux.HandleFunc("POST /api/runs/{id}/cancel", s.auth(s.cancelRun))
+	return mux
+}
+
+// ProbeHandler возвращает HTTP-обработчик только для проб; токен для него не нужен
+func (s *Server) ProbeHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerProbes(mux)
+	return mux
+}
+
+// registerProbes регистрирует пробы, доступные без аутентификации
+func (s *Server) registerProbes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.HandleFunc("GET /freshness", s.freshness)
+}
+
+// auth проверяет bearer-токен запроса
+func (s *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// listJobs возвращает список заданий с временем следующего и последнего запуска
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs := make([]JobInfo, 0, len(s.cfg.Backups))
+	for _, item := range s.cfg.Backups {
+		jobs = append(jobs, s.jobInfo(item))
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// runJob запускает задание вне расписания
+func (s *Server) runJob(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.cfg.Backup(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "backup not found")
+		return
+	}
+
+	id, err := s.runner.Start(s.ctx, item, runner.TriggerAPI)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id})
+}
+
+// listRuns возвращает последние запуски
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.runner.Runs())
+}
+
+// getRun возвращает статус и лог запуска
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.runner.GetRun(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// cancelRun отменяет выполняющийся запуск
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.runner.GetRun(id); !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if err := s.runner.Cancel(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, runner.ErrNotRunning) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "status": "cancelling"})
+}
+
+// jobInfo собирает сведения о задании из конфигурации, планировщика и истории запусков
+func (s *Server) jobInfo(item config.ConfigBackup) JobInfo {
+	info := JobInfo{
+		Name:     item.Name,
+		Type:     item.Type,
+		Schedule: item.Schedule,
+		Running:  s.runner.Running(item.Name),
+		Skipped:  s.runner.Skipped(item.Name),
+	}
+
+	if item.Schedule != "" {
+		if jobs, err := s.scheduler.FindJobsByTag(item.Name); err == nil && len(jobs) > 0 {
+			if next := jobs[0].NextRun(); !next.IsZero() {
+				info.NextRun = &next
+			}
+		}
+	}
+
+	if last, ok := s.runner.LastRun(item.Name); ok {
+		info.LastRun = &last
+	}
+	return info
+}
+
+// writeJSON отправляет ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError отправляет ошибку в формате JSON
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/minio"
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// probeTimeout ограничивает время обращений к MinIO из проб
+const probeTimeout = 5 * time.Second
+
+// archiveTimestampPattern соответствует временной метке запуска в именах архивов
+var archiveTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z`)
+
+// Freshness описывает актуальность последней успешной копии задания
+type Freshness struct {
+	Name        string     `json:"name"`
+	MaxAge      string     `json:"max_age"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	AgeSeconds  int64      `json:"age_seconds,omitempty"`
+	Fresh       bool       `json:"fresh"`
+}
+
+// healthz сообщает, что процесс работает и планировщик запущен
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	if !s.scheduler.IsRunning() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "scheduler stopped"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz проверяет доступность MinIO и наличие бакета
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	exists, err := minio.BucketExists(ctx, s.bucket)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "minio unreachable", "error": err.Error()})
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "bucket not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// freshness возвращает 503, если последняя успешная копия какого-либо задания старше его max-age
+func (s *Server) freshness(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	status := http.StatusOK
+	result := []Freshness{}
+
+	for _, item := range s.cfg.Backups {
+		if item.MaxAge <= 0 {
+			continue
+		}
+
+		entry := Freshness{Name: item.Name, MaxAge: item.MaxAge.String()}
+		if last := s.lastSuccess(r.Context(), item); !last.IsZero() {
+			entry.LastSuccess = &last
+			entry.AgeSeconds = int64(now.Sub(last).Seconds())
+			entry.Fresh = now.Sub(last) <= item.MaxAge
+		}
+		if !entry.Fresh {
+			status = http.StatusServiceUnavailable
+		}
+		result = append(result, entry)
+	}
+
+	writeJSON(w, status, result)
+}
+
+// lastSuccess возвращает время последней успешной копии. Если с момента старта
+// успешных запусков не было, используется время самого нового архива в бакете.
+func (s *Server) lastSuccess(ctx context.Context, item config.ConfigBackup) time.Time {
+	if last := s.runner.LastSuccess(item.Name); !last.IsZero() {
+		return last
+	}
+
+	s.mu.Lock()
+	cached, ok := s.stored[item.Name]
+	s.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	prefix := minio.ObjectPrefix(s.cfg.Project, item.ObjectPath())
+	objects, err := minio.ListObjects(ctx, s.bucket, prefix)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var latest time.Time
+	for _, object := range objects {
+		// WAL-сегменты, binlog-файлы и индексы пишутся и тогда, когда сами бэкапы не удаются,
+		// поэтому учитываются только архивы запусков, в имени которых есть временная метка
+		first, _, _ := strings.Cut(strings.TrimPrefix(object.Key, prefix), "/")
+		if !archiveTimestampPattern.MatchString(first) {
+			continue
+		}
+		if object.LastModified.After(latest) {
+			latest = object.LastModified.UTC()
+		}
+	}
+
+	// Кэшируем только найденное значение, чтобы не опрашивать бакет при каждой пробе
+	if !latest.IsZero() {
+		s.mu.Lock()
+		s.stored[item.Name] = latest
+		s.mu.Unlock()
+	}
+	return latest
+}
@@ -0,0 +1,227 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chStub - заглушка HTTP-интерфейса ClickHouse с базой analytics
+type chStub struct {
+	mu          sync.Mutex
+	unsupported bool              // BACKUP отвергается как неподдерживаемый
+	data        map[string]string // Данные таблиц в формате Native
+	backup      string            // Текст запроса BACKUP
+	polls       int               // Количество опросов system.backups
+	exported    []string          // Таблицы, выгруженные в формате Native
+	user, key   string            // Учетные данные последнего запроса
+}
+
+// chTables - строки system.tables; представление без данных идет последним
+const chTables = `{"name":"events","engine":"MergeTree","create_table_query":"CREATE TABLE analytics.events (id UInt64) ENGINE = MergeTree ORDER BY id","has_data":1}
+{"name":"tmp_import","engine":"MergeTree","create_table_query":"CREATE TABLE analytics.tmp_import (id UInt64) ENGINE = MergeTree ORDER BY id","has_data":1}
+{"name":"users","engine":"MergeTree","create_table_query":"CREATE TABLE analytics.users (id UInt64) ENGINE = MergeTree ORDER BY id","has_data":1}
+{"name":"daily","engine":"View","create_table_query":"CREATE VIEW analytics.daily AS SELECT count() FROM analytics.events","has_data":0}
+`
+
+func newCHStub(t *testing.T, stub *chStub) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	t.Cleanup(server.Close)
+	return strings.Replace(server.URL, "http://", "http://backup:chpass@", 1) + "/analytics"
+}
+
+func (s *chStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user, s.key = r.Header.Get("X-ClickHouse-User"), r.Header.Get("X-ClickHouse-Key")
+
+	body, _ := io.ReadAll(r.Body)
+	query := string(body)
+	switch {
+	case strings.Contains(query, "FROM system.tables"):
+		if r.URL.Query().Get("param_db") != "analytics" {
+			http.Error(w, "Code: 81. DB::Exception: Database does not exist", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, chTables)
+
+	case strings.HasPrefix(query, "BACKUP "):
+		s.backup = query
+		if s.unsupported {
+			http.Error(w, "Code: 344. DB::Exception: Support for BACKUP is disabled. (SUPPORT_IS_DISABLED)", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, "a1b2c3\tCREATING_BACKUP\n")
+
+	case strings.Contains(query, "FROM system.backups"):
+		s.polls++
+		status := "CREATING_BACKUP"
+		if s.polls > 1 {
+			status = "BACKUP_CREATED"
+		}
+		// UInt64 передаются строками, как в настройках ClickHouse по умолчанию
+		fmt.Fprintf(w, `{"id":"a1b2c3","status":%q,"num_files":"12","uncompressed_size":"52428800","compressed_size":"10485760","error":""}`+"\n", status)
+
+	case strings.HasSuffix(query, " FORMAT Native"):
+		if r.URL.Query().Get("wait_end_of_query") != "1" {
+			http.Error(w, "expected wait_end_of_query", http.StatusBadRequest)
+			return
+		}
+		for table, data := range s.data {
+			if query == "SELECT * FROM `analytics`.`"+table+"` FORMAT Native" {
+				s.exported = append(s.exported, table)
+				io.WriteString(w, data)
+				return
+			}
+		}
+		http.Error(w, "Code: 60. DB::Exception: Table does not exist", http.StatusNotFound)
+
+	default:
+		http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+	}
+}
+
+func init() {
+	chPollInterval = 10 * time.Millisecond
+}
+
+func chTestItem(source string) config.ConfigBackup {
+	return config.ConfigBackup{
+		Name:     "analytics-ch",
+		Type:     "clickhouse",
+		Source:   source,
+		PathSave: "ch",
+		ClickHouse: config.ClickHouseOptions{
+			ExcludeTables: []string{"tmp_*"},
+			S3Endpoint:    "http://minio:9000/",
+		},
+	}
+}
+
+func TestBackupClickHouseToS3(t *testing.T) {
+	t.Setenv("MINIO_ACCESS_KEY", "minio-access")
+	t.Setenv("MINIO_SECRET_KEY", "minio-secret")
+	cfg := &config.BackupConfig{Project: "prod"}
+	noUpload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		return "", fmt.Errorf("unexpected upload of %s", name)
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		target     string
+	}{
+		{name: "server credentials", target: `'http://minio:9000/backups/prod/ch/analytics-ch-TS/'`},
+		{name: "named collection", collection: "minio_backups", target: "`minio_backups`, url = 'http://minio:9000/backups/prod/ch/analytics-ch-TS/'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &chStub{}
+			item := chTestItem(newCHStub(t, stub))
+			item.ClickHouse.NamedCollection = tt.collection
+
+			keys, size, err := BackupClickHouse(context.Background(), cfg, item, "backups", noUpload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stub.user != "backup" || stub.key != "chpass" {
+				t.Errorf("credentials = %q/%q", stub.user, stub.key)
+			}
+
+			// Ключи MinIO не попадают в текст запроса
+			if strings.Contains(stub.backup, "minio-access") || strings.Contains(stub.backup, "minio-secret") {
+				t.Fatalf("BACKUP query contains MinIO keys: %s", stub.backup)
+			}
+			query := regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z`).ReplaceAllString(stub.backup, "TS")
+			want := "BACKUP TABLE `analytics`.`events`, TABLE `analytics`.`users`, TABLE `analytics`.`daily` TO S3(" + tt.target + ") ASYNC"
+			if query != want {
+				t.Errorf("query:\n%s\nwant:\n%s", query, want)
+			}
+
+			if len(keys) != 1 || !strings.HasPrefix(keys[0], "prod/ch/analytics-ch-") || !strings.HasSuffix(keys[0], "/") {
+				t.Errorf("keys = %v", keys)
+			}
+			if size != 52428800 {
+				t.Errorf("size = %d, want uncompressed_size", size)
+			}
+			if stub.polls < 2 {
+				t.Errorf("system.backups polled %d times, want at least 2", stub.polls)
+			}
+		})
+	}
+}
+
+func TestBackupClickHouseNativeFallback(t *testing.T) {
+	stub := &chStub{
+		unsupported: true,
+		data: map[string]string{
+			"events":     strings.Repeat("event-block", 1000),
+			"tmp_import": "must not be exported",
+			"users":      "user-block",
+		},
+	}
+	item := chTestItem(newCHStub(t, stub))
+	item.ClickHouse.Tables = []string{"events", "users", "tmp_*", "daily"}
+
+	uploaded := make(map[string][]byte)
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(gzr)
+		uploaded[regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z`).ReplaceAllString(name, "TS")] = data
+		return "prod/ch/" + name, err
+	}
+
+	keys, size, err := BackupClickHouse(context.Background(), &config.BackupConfig{Project: "prod"}, item, "backups", upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Errorf("keys = %v, want schema and two tables", keys)
+	}
+	if want := int64(len(stub.data["events"]) + len(stub.data["users"])); size != want {
+		t.Errorf("size = %d, want %d", size, want)
+	}
+	if strings.Join(stub.exported, ",") != "events,users" {
+		t.Errorf("exported tables = %v", stub.exported)
+	}
+
+	schema := string(uploaded["analytics-TS.schema.sql.gz"])
+	if !strings.Contains(schema, "CREATE TABLE analytics.users") || strings.Contains(schema, "tmp_import") {
+		t.Errorf("unexpected schema:\n%s", schema)
+	}
+	if strings.Index(schema, "CREATE VIEW") < strings.Index(schema, "CREATE TABLE analytics.users") {
+		t.Error("view is created before the tables")
+	}
+	if !bytes.Equal(uploaded["analytics.events-TS.native.gz"], []byte(stub.data["events"])) {
+		t.Error("events data does not match")
+	}
+}
+
+func TestBackupClickHouseBackupMethodNoFallback(t *testing.T) {
+	stub := &chStub{unsupported: true}
+	item := chTestItem(newCHStub(t, stub))
+	item.ClickHouse.Method = config.ClickHouseMethodBackup
+
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		t.Errorf("unexpected upload of %s", name)
+		return "", nil
+	}
+	_, _, err := BackupClickHouse(context.Background(), &config.BackupConfig{Project: "prod"}, item, "backups", upload)
+	if err == nil || !strings.Contains(err.Error(), "SUPPORT_IS_DISABLED") {
+		t.Fatalf("expected BACKUP error, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/throttle"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commandOutputDirPlaceholder заменяется в аргументах команды директорией вывода
+const commandOutputDirPlaceholder = "{output_dir}"
+
+// countingWriter считает записанные байты
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// BackupCommand выполняет команду из настроек бэкапа и загружает ее stdout, сжатый gzip,
+// в бакет как <имя>-<timestamp>.<extension>.gz без промежуточного файла.
+// Ненулевой код завершения отменяет загрузку; stderr попадает в лог.
+func BackupCommand(ctx context.Context, backupItem config.ConfigBackup, upload streamUploader) (string, error) {
+	opts := backupItem.Command
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	name := fmt.Sprintf("%s-%s.%s.gz", backupItem.Name, timestamp, opts.FileExtension())
+
+	var output countingWriter
+	key, err := streamGzip(ctx, name, upload, func(w io.Writer) error {
+		output.w = w
+		cmd := commandCmd(ctx, opts, "")
+		cmd.Stdout = &output
+		return runTool(ctx, cmd)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if output.n == 0 {
+		logging.FromContext(ctx).Warn("command produced no output", "command", opts.Command)
+	}
+	return key, nil
+}
+
+// BackupCommandDir выполняет команду, которая пишет файлы в выделенную директорию
+// (путь передается в BACKUP_OUTPUT_DIR и подставляется вместо {output_dir} в аргументах),
+// и архивирует ее в <имя>-<timestamp>.tar.gz. Возвращает путь к архиву.
+func BackupCommandDir(ctx context.Context, backupItem config.ConfigBackup, outputDir string, limiters ...*throttle.Limiter) (string, error) {
+	opts := backupItem.Command
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+
+	dir := filepath.Join(outputDir, fmt.Sprintf("%s-%s", backupItem.Name, timestamp))
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	if err := runTool(ctx, commandCmd(ctx, opts, dir)); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read output directory: %w", err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("command produced no files in the output directory")
+	}
+
+	return TarFolder(ctx, dir, dir+".tar.gz", nil, limiters...)
+}
+
+// commandCmd создает процесс команды; outputDir передается команде, если задан
+func commandCmd(ctx context.Context, opts config.CommandOptions, outputDir string) *exec.Cmd {
+	args := opts.Args
+	if outputDir != "" {
+		args = make([]string, len(opts.Args))
+		for i, arg := range opts.Args {
+			args[i] = strings.ReplaceAll(arg, commandOutputDirPlaceholder, outputDir)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, opts.Command, args...)
+	cmd.Dir = opts.Dir
+	cmd.Env = os.Environ()
+	if outputDir != "" {
+		cmd.Env = append(cmd.Env, "BACKUP_OUTPUT_DIR="+outputDir)
+	}
+	for key, value := range opts.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	return cmd
+}
@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"archive/tar"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logBuffer - потокобезопасный буфер для записей лога
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog возвращает контекст, логгер которого пишет все уровни в буфер
+func captureLog() (context.Context, *logBuffer) {
+	var buf logBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	return logging.WithLogger(context.Background(), logger), &buf
+}
+
+// shItem - бэкап command, который выполняет script в /bin/sh
+func shItem(script string) config.ConfigBackup {
+	return config.ConfigBackup{
+		Name:    "ldap",
+		Type:    "command",
+		Command: config.CommandOptions{Command: "/bin/sh", Args: []string{"-c", script}},
+	}
+}
+
+// gzipUpload распаковывает загружаемый поток в data и запоминает имя объекта
+type gzipUpload struct {
+	name string
+	data []byte
+	err  error // Ошибка чтения потока, с которой загрузка была прервана
+}
+
+func (u *gzipUpload) upload(ctx context.Context, name string, r io.Reader) (string, error) {
+	u.name = name
+	var compressed bytes.Buffer
+	if _, u.err = io.Copy(&compressed, r); u.err != nil {
+		return "", u.err
+	}
+	gzr, err := gzip.NewReader(&compressed)
+	if err != nil {
+		return "", err
+	}
+	u.data, err = io.ReadAll(gzr)
+	return "prod/ldap/" + name, err
+}
+
+func TestBackupCommand(t *testing.T) {
+	item := shItem(`echo "dn: $BASE_DN"; echo "2 entries exported" >&2`)
+	item.Command.Env = map[string]string{"BASE_DN": "dc=example,dc=com"}
+	item.Command.Extension = ".ldif"
+
+	ctx, logs := captureLog()
+	var upload gzipUpload
+	key, err := BackupCommand(ctx, item, upload.upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "prod/ldap/"+upload.name || !strings.HasPrefix(upload.name, "ldap-") || !strings.HasSuffix(upload.name, ".ldif.gz") {
+		t.Errorf("unexpected object %q (key %q)", upload.name, key)
+	}
+	if string(upload.data) != "dn: dc=example,dc=com\n" {
+		t.Errorf("uploaded %q", upload.data)
+	}
+	// stderr не попадает в архив, но остается в логе
+	if !strings.Contains(logs.String(), `stderr="2 entries exported"`) {
+		t.Errorf("stderr is not logged:\n%s", logs)
+	}
+	if strings.Contains(logs.String(), "command produced no output") {
+		t.Error("unexpected empty output warning")
+	}
+}
+
+func TestBackupCommandFailure(t *testing.T) {
+	ctx, logs := captureLog()
+	var upload gzipUpload
+	key, err := BackupCommand(ctx, shItem(`echo partial; echo "disk full" >&2; exit 3`), upload.upload)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected exit status error, got %v", err)
+	}
+	if key != "" {
+		t.Errorf("key = %q after failure", key)
+	}
+	// Загрузка прерывается, а не завершается с частичным выводом
+	if upload.err == nil {
+		t.Error("upload was not aborted")
+	}
+	if !strings.Contains(logs.String(), "exit_code=3") || !strings.Contains(logs.String(), `stderr="disk full"`) {
+		t.Errorf("failure is not logged with exit code and stderr:\n%s", logs)
+	}
+}
+
+func TestBackupCommandEmptyOutput(t *testing.T) {
+	ctx, logs := captureLog()
+	var upload gzipUpload
+	if _, err := BackupCommand(ctx, shItem("true"), upload.upload); err != nil {
+		t.Fatal(err)
+	}
+	if len(upload.data) != 0 {
+		t.Errorf("uploaded %q", upload.data)
+	}
+	if !strings.Contains(logs.String(), "level=WARN msg=\"command produced no output\"") {
+		t.Errorf("no empty output warning:\n%s", logs)
+	}
+}
+
+func TestBackupCommandDir(t *testing.T) {
+	// {output_dir} в аргументах и BACKUP_OUTPUT_DIR указывают на одну директорию
+	item := shItem(`echo snapshot > "{output_dir}/etcd.snap" && mkdir "$BACKUP_OUTPUT_DIR/wal" && echo segment > "$BACKUP_OUTPUT_DIR/wal/0001"`)
+	item.Command.OutputDir = true
+
+	outputDir := t.TempDir()
+	archive, err := BackupCommandDir(context.Background(), item, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(archive) != outputDir || !strings.HasPrefix(filepath.Base(archive), "ldap-") || !strings.HasSuffix(archive, ".tar.gz") {
+		t.Errorf("unexpected archive %s", archive)
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	files := make(map[string]string)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Base(filepath.Dir(header.Name)) + "/" + filepath.Base(header.Name)
+		names = append(names, name)
+		files[name] = string(data)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || files["wal/0001"] != "segment\n" || !strings.HasSuffix(names[0], "/etcd.snap") || files[names[0]] != "snapshot\n" {
+		t.Errorf("archive files = %v", files)
+	}
+}
+
+func TestBackupCommandDirEmpty(t *testing.T) {
+	item := shItem(`echo "nothing to export"`)
+	item.Command.OutputDir = true
+	_, err := BackupCommandDir(context.Background(), item, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no files in the output directory") {
+		t.Fatalf("expected empty output directory error, got %v", err)
+	}
+}
+
+func TestBackupCommandDirFailure(t *testing.T) {
+	item := shItem(`echo partial > "$BACKUP_OUTPUT_DIR/dump"; exit 2`)
+	item.Command.OutputDir = true
+	ctx, _ := captureLog()
+	_, err := BackupCommandDir(ctx, item, t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "exit status 2") {
+		t.Fatalf("expected exit status error, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Параметры ожидания снимка Elasticsearch
+const (
+	esRequestTimeout = time.Minute
+	esCleanupTimeout = 30 * time.Second
+)
+
+// esPollInterval - интервал опроса состояния снимка (тесты уменьшают его)
+var esPollInterval = 5 * time.Second
+
+// Состояния снимка Elasticsearch
+const (
+	esStateInProgress = "IN_PROGRESS"
+	esStateSuccess    = "SUCCESS"
+)
+
+// esSnapshot описывает снимок в ответе /_snapshot
+type esSnapshot struct {
+	Snapshot    string            `json:"snapshot"`
+	State       string            `json:"state"`
+	StartTimeMs int64             `json:"start_time_in_millis"`
+	DurationMs  int64             `json:"duration_in_millis"`
+	Indices     []string          `json:"indices"`
+	Failures    []json.RawMessage `json:"failures"`
+}
+
+// esClient выполняет запросы к REST API кластера
+type esClient struct {
+	baseURL  *url.URL
+	http     *http.Client
+	username string
+	password string
+	apiKey   string
+}
+
+// BackupElasticsearch создает снимок кластера Elasticsearch/OpenSearch в S3-репозитории,
+// указывающем на бакет и путь бэкапа, ждет его завершения и удаляет старые снимки.
+// Данные пишет сам кластер, поэтому локального артефакта нет; возвращается путь репозитория в бакете.
+func BackupElasticsearch(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string) (string, error) {
+	client, err := newESClient(backupItem)
+	if err != nil {
+		return "", err
+	}
+
+	opts := backupItem.Elasticsearch
+	repository := opts.Repository
+	if repository == "" {
+		repository = backupItem.Name
+	}
+	basePath := strings.TrimSuffix(minio.ObjectPrefix(cfg.Project, backupItem.ObjectPath()), "/")
+	logger := logging.FromContext(ctx).With("repository", repository)
+
+	// Регистрация репозитория идемпотентна: повторный PUT обновляет настройки
+	settings := map[string]any{
+		"bucket":    bucketName,
+		"base_path": basePath,
+		"client":    "default",
+	}
+	if opts.Client != "" {
+		settings["client"] = opts.Client
+	}
+	for key, value := range opts.RepositorySettings {
+		settings[key] = value
+	}
+	if err := client.do(ctx, http.MethodPut, "/_snapshot/"+url.PathEscape(repository), map[string]any{
+		"type":     "s3",
+		"settings": settings,
+	}, nil); err != nil {
+		return "", fmt.Errorf("failed to register repository: %w", err)
+	}
+
+	// Имена снимков должны быть в нижнем регистре
+	snapshotName := strings.ToLower(fmt.Sprintf("%s-%s", backupItem.Name, time.Now().Format("2006-01-02T15-04-05Z")))
+	snapshotPath := "/_snapshot/" + url.PathEscape(repository) + "/" + url.PathEscape(snapshotName)
+
+	indices := "*"
+	if len(opts.Indices) > 0 {
+		indices = strings.Join(opts.Indices, ",")
+	}
+	if err := client.do(ctx, http.MethodPut, snapshotPath+"?wait_for_completion=false", map[string]any{
+		"indices":              indices,
+		"ignore_unavailable":   true,
+		"include_global_state": opts.IncludeGlobalState,
+	}, nil); err != nil {
+		return "", fmt.Errorf("failed to start snapshot: %w", err)
+	}
+	logger.Info("snapshot started", "snapshot", snapshotName, "indices", indices)
+
+	snapshot, err := client.waitSnapshot(ctx, snapshotPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Удаление выполняющегося снимка прерывает его
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), esCleanupTimeout)
+			defer cancel()
+			if delErr := client.do(cleanupCtx, http.MethodDelete, snapshotPath, nil, nil); delErr != nil {
+				logger.Warn("failed to abort snapshot", "snapshot", snapshotName, "error", delErr)
+			}
+		}
+		return "", err
+	}
+	if snapshot.State != esStateSuccess {
+		failures, _ := json.Marshal(snapshot.Failures)
+		return "", fmt.Errorf("snapshot %s finished with state %s: %s", snapshotName, snapshot.State, failures)
+	}
+	logger.Info("snapshot completed",
+		"snapshot", snapshotName,
+		"indices", len(snapshot.Indices),
+		"duration", (time.Duration(snapshot.DurationMs) * time.Millisecond).String(),
+	)
+
+	// Префикс в том же регистре, что и имена снимков, иначе снимки бэкапа с заглавными буквами не найдутся
+	if err := client.applyRetention(ctx, repository, strings.ToLower(backupItem.Name)+"-", snapshotName, opts); err != nil {
+		return "", fmt.Errorf("retention failed: %w", err)
+	}
+
+	return basePath + "/", nil
+}
+
+// newESClient создает клиента по адресу кластера из source
+func newESClient(backupItem config.ConfigBackup) (*esClient, error) {
+	baseURL, err := url.Parse(backupItem.Source)
+	if err != nil || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid Elasticsearch URL: %s", backupItem.Source)
+	}
+
+	client := &esClient{
+		baseURL: &url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: strings.TrimSuffix(baseURL.Path, "/")},
+		http:    &http.Client{Timeout: esRequestTimeout},
+		apiKey:  backupItem.Elasticsearch.APIKey,
+	}
+	if baseURL.User != nil {
+		client.username = baseURL.User.Username()
+		client.password, _ = baseURL.User.Password()
+	}
+
+	if caFile := backupItem.Elasticsearch.CAFile; caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		client.http.Transport = transport
+	}
+	return client, nil
+}
+
+// do выполняет запрос с JSON-телом и разбирает JSON-ответ в result (если не nil)
+func (c *esClient) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := *c.baseURL
+	rawPath, rawQuery, _ := strings.Cut(path, "?")
+	target.RawPath = c.baseURL.Path + rawPath
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	target.RawQuery = rawQuery
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case c.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.apiKey)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, rawPath, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return nil
+}
+
+// waitSnapshot опрашивает состояние снимка, пока он выполняется
+func (c *esClient) waitSnapshot(ctx context.Context, snapshotPath string) (*esSnapshot, error) {
+	for {
+		var response struct {
+			Snapshots []esSnapshot `json:"snapshots"`
+		}
+		if err := c.do(ctx, http.MethodGet, snapshotPath, nil, &response); err != nil {
+			return nil, fmt.Errorf("failed to get snapshot state: %w", err)
+		}
+		if len(response.Snapshots) == 0 {
+			return nil, fmt.Errorf("snapshot not found")
+		}
+		if snapshot := response.Snapshots[0]; snapshot.State != esStateInProgress {
+			return &snapshot, nil
+		}
+
+		timer := time.NewTimer(esPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// applyRetention удаляет снимки этого бэкапа сверх keep и старше keep-for.
+// Учитываются только снимки с префиксом имени бэкапа; текущий снимок не удаляется.
+func (c *esClient) applyRetention(ctx context.Context, repository, prefix, current string, opts config.ElasticsearchOptions) error {
+	if opts.Keep == 0 && opts.KeepFor == 0 {
+		return nil
+	}
+
+	var response struct {
+		Snapshots []esSnapshot `json:"snapshots"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/_snapshot/"+url.PathEscape(repository)+"/_all", nil, &response); err != nil {
+		return err
+	}
+
+	var snapshots []esSnapshot
+	for _, snapshot := range response.Snapshots {
+		if strings.HasPrefix(snapshot.Snapshot, prefix) && snapshot.State != esStateInProgress {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	// Новые снимки первыми
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].StartTimeMs > snapshots[j].StartTimeMs
+	})
+
+	logger := logging.FromContext(ctx)
+	now := time.Now()
+	for i, snapshot := range snapshots {
+		if snapshot.Snapshot == current {
+			continue
+		}
+		expired := opts.KeepFor > 0 && now.Sub(time.UnixMilli(snapshot.StartTimeMs)) > opts.KeepFor
+		excess := opts.Keep > 0 && i >= opts.Keep
+		if !expired && !excess {
+			continue
+		}
+
+		path := "/_snapshot/" + url.PathEscape(repository) + "/" + url.PathEscape(snapshot.Snapshot)
+		if err := c.do(ctx, http.MethodDelete, path, nil, nil); err != nil {
+			return err
+		}
+		logger.Info("old snapshot deleted", "snapshot", snapshot.Snapshot)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// esStub - заглушка REST API снимков: один репозиторий, снимок завершается после первого опроса
+type esStub struct {
+	mu         sync.Mutex
+	finalState string         // Состояние, с которым завершается новый снимок
+	existing   []esSnapshot   // Снимки, уже лежащие в репозитории
+	repository map[string]any // Тело регистрации репозитория
+	request    map[string]any // Тело запроса создания снимка
+	created    string         // Имя созданного снимка
+	polls      int            // Количество опросов состояния
+	deleted    []string       // Удаленные снимки
+	auth       string         // Заголовок Authorization последнего запроса
+}
+
+func newESStub(t *testing.T, stub *esStub) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func (s *esStub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = r.Header.Get("Authorization")
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/_snapshot/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/_snapshot/") || parts[0] != "logs" {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case r.Method == http.MethodPut && len(parts) == 1:
+		s.repository = body
+		w.Write([]byte(`{"acknowledged":true}`))
+
+	case r.Method == http.MethodPut && len(parts) == 2:
+		if r.URL.Query().Get("wait_for_completion") != "false" {
+			http.Error(w, `{"error":"expected asynchronous snapshot"}`, http.StatusBadRequest)
+			return
+		}
+		s.created, s.request = parts[1], body
+		w.Write([]byte(`{"accepted":true}`))
+
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == "_all":
+		snapshots := append([]esSnapshot(nil), s.existing...)
+		snapshots = append(snapshots, s.snapshot())
+		json.NewEncoder(w).Encode(map[string]any{"snapshots": snapshots})
+
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[1] == s.created:
+		s.polls++
+		json.NewEncoder(w).Encode(map[string]any{"snapshots": []esSnapshot{s.snapshot()}})
+
+	case r.Method == http.MethodDelete && len(parts) == 2:
+		s.deleted = append(s.deleted, parts[1])
+		w.Write([]byte(`{"acknowledged":true}`))
+
+	default:
+		http.Error(w, `{"error":"unexpected request"}`, http.StatusBadRequest)
+	}
+}
+
+// snapshot возвращает состояние созданного снимка: первый опрос застает его выполняющимся
+func (s *esStub) snapshot() esSnapshot {
+	snapshot := esSnapshot{
+		Snapshot:    s.created,
+		State:       esStateInProgress,
+		StartTimeMs: time.Now().UnixMilli(),
+		Indices:     []string{"logs-2024.05.01"},
+	}
+	if s.polls > 1 {
+		snapshot.State = s.finalState
+		snapshot.DurationMs = 1500
+	}
+	if snapshot.State == "FAILED" {
+		snapshot.Failures = []json.RawMessage{json.RawMessage(`{"index":"logs-2024.05.01","reason":"disk full"}`)}
+	}
+	return snapshot
+}
+
+func init() {
+	esPollInterval = 10 * time.Millisecond
+}
+
+func esTestItem(source string) config.ConfigBackup {
+	return config.ConfigBackup{
+		Name:     "Logs-ES",
+		Type:     "elasticsearch",
+		Source:   source,
+		PathSave: "search/logs",
+		Elasticsearch: config.ElasticsearchOptions{
+			Repository: "logs",
+			Indices:    []string{"logs-*", "audit"},
+			APIKey:     "c2VjcmV0",
+			Keep:       2,
+			KeepFor:    7 * 24 * time.Hour,
+		},
+	}
+}
+
+func TestBackupElasticsearch(t *testing.T) {
+	now := time.Now()
+	stub := &esStub{
+		finalState: esStateSuccess,
+		existing: []esSnapshot{
+			{Snapshot: "logs-es-2024-05-09t00-00-00z", State: esStateSuccess, StartTimeMs: now.Add(-24 * time.Hour).UnixMilli()},
+			{Snapshot: "logs-es-2024-05-08t00-00-00z", State: esStateSuccess, StartTimeMs: now.Add(-48 * time.Hour).UnixMilli()},
+			{Snapshot: "logs-es-2024-04-01t00-00-00z", State: "PARTIAL", StartTimeMs: now.Add(-40 * 24 * time.Hour).UnixMilli()},
+			{Snapshot: "logs-es-running", State: esStateInProgress, StartTimeMs: now.Add(-96 * time.Hour).UnixMilli()},
+			// Снимки другого бэкапа в том же репозитории не трогаются
+			{Snapshot: "metrics-2024-04-01t00-00-00z", State: esStateSuccess, StartTimeMs: now.Add(-40 * 24 * time.Hour).UnixMilli()},
+		},
+	}
+	source := newESStub(t, stub)
+
+	cfg := &config.BackupConfig{Project: "prod"}
+	key, err := BackupElasticsearch(context.Background(), cfg, esTestItem(source), "backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "prod/search/logs/" {
+		t.Errorf("key = %q", key)
+	}
+
+	// Репозиторий указывает на бакет и путь бэкапа
+	settings, _ := stub.repository["settings"].(map[string]any)
+	if stub.repository["type"] != "s3" || settings["bucket"] != "backups" || settings["base_path"] != "prod/search/logs" || settings["client"] != "default" {
+		t.Errorf("unexpected repository registration: %v", stub.repository)
+	}
+	if stub.auth != "ApiKey c2VjcmV0" {
+		t.Errorf("Authorization = %q", stub.auth)
+	}
+
+	if !strings.HasPrefix(stub.created, "logs-es-") || stub.created != strings.ToLower(stub.created) {
+		t.Errorf("snapshot name %q is not a lower-case name of the backup", stub.created)
+	}
+	if stub.request["indices"] != "logs-*,audit" || stub.request["ignore_unavailable"] != true {
+		t.Errorf("unexpected snapshot request: %v", stub.request)
+	}
+	if stub.polls < 2 {
+		t.Errorf("snapshot state polled %d times, want at least 2", stub.polls)
+	}
+
+	// keep: 2 оставляет новый снимок и самый свежий старый; PARTIAL старше keep-for
+	slices.Sort(stub.deleted)
+	want := []string{"logs-es-2024-04-01t00-00-00z", "logs-es-2024-05-08t00-00-00z"}
+	if !slices.Equal(stub.deleted, want) {
+		t.Errorf("deleted %v, want %v", stub.deleted, want)
+	}
+}
+
+func TestBackupElasticsearchFailedSnapshot(t *testing.T) {
+	stub := &esStub{
+		finalState: "FAILED",
+		existing: []esSnapshot{
+			{Snapshot: "logs-es-2024-04-01t00-00-00z", State: esStateSuccess, StartTimeMs: time.Now().Add(-40 * 24 * time.Hour).UnixMilli()},
+		},
+	}
+	source := newESStub(t, stub)
+
+	_, err := BackupElasticsearch(context.Background(), &config.BackupConfig{Project: "prod"}, esTestItem(source), "backups")
+	if err == nil || !strings.Contains(err.Error(), "FAILED") || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected failed snapshot error, got %v", err)
+	}
+	// После неудачного снимка старые не удаляются
+	if len(stub.deleted) != 0 {
+		t.Errorf("deleted %v after a failed snapshot", stub.deleted)
+	}
+}
+
+func TestBackupElasticsearchRepositoryError(t *testing.T) {
+	source := newESStub(t, &esStub{finalState: esStateSuccess})
+	item := esTestItem(source)
+	item.Elasticsearch.Repository = "missing"
+
+	_, err := BackupElasticsearch(context.Background(), &config.BackupConfig{Project: "prod"}, item, "backups")
+	if err == nil || !strings.Contains(err.Error(), "failed to register repository") {
+		t.Fatalf("expected repository error, got %v", err)
+	}
+}
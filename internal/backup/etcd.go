@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+// etcdDialTimeout ограничивает время подключения к etcd
+const etcdDialTimeout = 10 * time.Second
+
+// BackupEtcd получает снимок etcd через Maintenance Snapshot API и загружает его потоком, сжатым gzip.
+// Сервер завершает снимок SHA-256 от предшествующих данных; хэш проверяется до завершения загрузки,
+// а при несовпадении загрузка отменяется. Снимок сохраняется целиком, вместе с хэшем, как etcdctl snapshot save.
+// Возвращает ключ объекта и хэш снимка в шестнадцатеричном виде.
+func BackupEtcd(ctx context.Context, backupItem config.ConfigBackup, upload streamUploader) (string, string, error) {
+	var endpoints []string
+	for _, endpoint := range strings.Split(backupItem.Source, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return "", "", fmt.Errorf("etcd endpoints are required")
+	}
+
+	tlsConfig, err := etcdTLSConfig(backupItem.Etcd)
+	if err != nil {
+		return "", "", err
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdDialTimeout,
+		TLS:         tlsConfig,
+		Username:    backupItem.Etcd.Username,
+		Password:    backupItem.Etcd.Password,
+		Context:     ctx,
+		Logger:      zap.NewNop(), // Ошибки возвращаются вызывающему коду и попадают в лог запуска
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+	defer client.Close()
+
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	archiveName := fmt.Sprintf("%s-%s.db.gz", backupItem.Name, timestamp)
+
+	var hash []byte
+	key, err := streamGzip(ctx, archiveName, upload, func(w io.Writer) error {
+		snapshot, err := client.Snapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("snapshot request failed: %w", err)
+		}
+		defer snapshot.Close()
+
+		var size int64
+		size, hash, err = copyVerifiedSnapshot(w, snapshot)
+		if err != nil {
+			return err
+		}
+		logging.FromContext(ctx).Info("etcd snapshot received", "size", size)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return key, hex.EncodeToString(hash), nil
+}
+
+// copyVerifiedSnapshot копирует снимок в w, проверяет SHA-256 в последних байтах потока и возвращает его
+func copyVerifiedSnapshot(w io.Writer, r io.Reader) (int64, []byte, error) {
+	hash := sha256.New()
+	buf := make([]byte, 64<<10)
+	// Последние sha256.Size байт удерживаются: они могут оказаться хэшем
+	var pending []byte
+	var written int64
+	for {
+		n, readErr := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if len(pending) > sha256.Size {
+			flush := len(pending) - sha256.Size
+			hash.Write(pending[:flush])
+			m, err := w.Write(pending[:flush])
+			written += int64(m)
+			if err != nil {
+				return written, nil, err
+			}
+			pending = append(pending[:0], pending[flush:]...)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return written, nil, fmt.Errorf("snapshot transfer interrupted: %w", readErr)
+		}
+	}
+
+	if len(pending) != sha256.Size || !bytes.Equal(pending, hash.Sum(nil)) {
+		return written, nil, fmt.Errorf("snapshot hash mismatch")
+	}
+	m, err := w.Write(pending)
+	return written + int64(m), pending, err
+}
+
+// etcdTLSConfig создает настройки TLS из файлов сертификатов; nil, если TLS не настроен
+func etcdTLSConfig(opts config.EtcdOptions) (*tls.Config, error) {
+	if opts.CertFile == "" && opts.KeyFile == "" && opts.CAFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load etcd client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read etcd CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startEmbeddedEtcd запускает etcd в процессе и возвращает адрес клиента
+func startEmbeddedEtcd(t *testing.T) string {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.Name + "=" + peerURL.String()
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("embedded etcd did not start")
+	}
+	return clientURL.String()
+}
+
+// freeURL возвращает адрес на свободном локальном порту
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+func TestBackupEtcd(t *testing.T) {
+	endpoint := startEmbeddedEtcd(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := client.Put(ctx, fmt.Sprintf("/registry/pods/pod-%03d", i), strings.Repeat("x", 1024)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var uploaded bytes.Buffer
+	var objectName string
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		objectName = name
+		_, err := io.Copy(&uploaded, r)
+		return "project/k8s-etcd/" + name, err
+	}
+
+	// Лишние пробелы и пустые адреса в списке допустимы
+	item := config.ConfigBackup{Name: "k8s-etcd", Type: "etcd", Source: " " + endpoint + ", "}
+	key, hash, err := BackupEtcd(ctx, item, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "project/k8s-etcd/"+objectName || !strings.HasPrefix(objectName, "k8s-etcd-") || !strings.HasSuffix(objectName, ".db.gz") {
+		t.Errorf("unexpected object %q (key %q)", objectName, key)
+	}
+
+	gzr, err := gzip.NewReader(&uploaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := io.ReadAll(gzr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) < 100*1024 {
+		t.Fatalf("snapshot is too small: %d bytes", len(snapshot))
+	}
+	// Снимок сохранен целиком, вместе с хэшем в конце, как его пишет etcdctl snapshot save
+	data, trailer := snapshot[:len(snapshot)-sha256.Size], snapshot[len(snapshot)-sha256.Size:]
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(trailer, sum[:]) {
+		t.Error("snapshot does not end with the SHA-256 of its data")
+	}
+	if hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("returned hash %s, want %x", hash, sum)
+	}
+}
+
+func TestBackupEtcdUnreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		_, err := io.Copy(io.Discard, r)
+		return name, err
+	}
+	endpoint := freeURL(t)
+	if _, _, err := BackupEtcd(ctx, config.ConfigBackup{Name: "etcd", Source: endpoint.String()}, upload); err == nil {
+		t.Fatal("expected error for unreachable etcd")
+	}
+}
+
+func TestCopyVerifiedSnapshotHashMismatch(t *testing.T) {
+	data := bytes.Repeat([]byte("snapshot"), 10000)
+	sum := sha256.Sum256(data)
+	corrupted := append(append([]byte(nil), data...), sum[:]...)
+	corrupted[100] ^= 0xff
+
+	if _, _, err := copyVerifiedSnapshot(io.Discard, bytes.NewReader(corrupted)); err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatalf("expected hash mismatch, got %v", err)
+	}
+	if _, _, err := copyVerifiedSnapshot(io.Discard, bytes.NewReader(data[:10])); err == nil {
+		t.Fatal("expected error for a snapshot shorter than its hash")
+	}
+}
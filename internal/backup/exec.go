@@ -0,0 +1,32 @@
+package backup
+
+import (
+	"backup-to-minio/internal/logging"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runTool выполняет внешнюю утилиту, захватывая stderr и записывая его в лог отдельным полем
+func runTool(ctx context.Context, cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	tool := filepath.Base(cmd.Path)
+	logger := logging.FromContext(ctx).With("tool", tool)
+	logger.Debug("running external tool")
+
+	err := cmd.Run()
+	output := strings.TrimSpace(stderr.String())
+	if err != nil {
+		logger.Error("external tool failed", "error", err, "exit_code", cmd.ProcessState.ExitCode(), "stderr", output)
+		return fmt.Errorf("%s failed: %w", tool, err)
+	}
+	if output != "" {
+		logger.Debug("external tool finished", "stderr", output)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Статусы резервного копирования, передаваемые хукам
+const (
+	hookStatusSuccess = "success"
+	hookStatusFailure = "failure"
+)
+
+// hookInfo содержит метаданные бэкапа, передаваемые хукам через переменные окружения
+type hookInfo struct {
+	Project string
+	Name    string
+	Type    string
+	Archive string // Локальный путь к архиву
+	Object  string // Ключ объекта в бакете
+	Size    int64  // Общий размер объектов запуска
+	Status  string // success или failure (пусто для pre-хуков)
+	Error   string // Текст ошибки при неудаче
+}
+
+// env возвращает переменные окружения с метаданными бэкапа
+func (h hookInfo) env() []string {
+	return []string{
+		"BACKUP_PROJECT=" + h.Project,
+		"BACKUP_NAME=" + h.Name,
+		"BACKUP_TYPE=" + h.Type,
+		"BACKUP_ARCHIVE=" + h.Archive,
+		"BACKUP_OBJECT=" + h.Object,
+		"BACKUP_SIZE=" + strconv.FormatInt(h.Size, 10),
+		"BACKUP_STATUS=" + h.Status,
+		"BACKUP_ERROR=" + h.Error,
+	}
+}
+
+// runHooks последовательно выполняет хуки этапа.
+// Ошибка необязательного хука записывается в лог, ошибка обязательного прерывает выполнение.
+func runHooks(ctx context.Context, stage string, hooks []config.Hook, info hookInfo) error {
+	ctx = logging.WithStage(ctx, stage+"-hook")
+	for _, hook := range hooks {
+		if err := runHook(ctx, hook, info); err != nil {
+			if hook.Optional {
+				logging.FromContext(ctx).Warn("optional hook failed", "hook", stage, "error", err)
+				continue
+			}
+			return fmt.Errorf("%s hook failed: %w", stage, err)
+		}
+	}
+	return nil
+}
+
+// runHook выполняет одну команду хука
+func runHook(ctx context.Context, hook config.Hook, info hookInfo) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Dir = hook.Dir
+	cmd.Env = append(os.Environ(), info.env()...)
+	for key, value := range hook.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	logger := logging.FromContext(ctx).With("command", hook.Command, "args", strings.Join(hook.Args, " "))
+	logger.Info("running hook")
+	if err := cmd.Run(); err != nil {
+		logger.Warn("hook failed", "error", err, "output", strings.TrimSpace(output.String()))
+		return fmt.Errorf("%s: %w", hook.Command, err)
+	}
+	logger.Debug("hook finished", "output", strings.TrimSpace(output.String()))
+	return nil
+}
@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestSuffix - суффикс манифеста, который записывается рядом с каждым объектом запуска
+const manifestSuffix = ".manifest.json"
+
+// runIndexDir - каталог в пути бэкапа с индексами запусков; имя индекса - время запуска,
+// поэтому хранение выбирает запуски по одному списку объектов, не читая манифесты
+const runIndexDir = ".runs/"
+
+// runIndexLayout - формат времени запуска в имени индекса
+const runIndexLayout = "2006-01-02T15-04-05Z"
+
+// Manifest описывает объект, созданный запуском бэкапа
+type Manifest struct {
+	Backup    string            `json:"backup"`
+	Type      string            `json:"type"`
+	CreatedAt time.Time         `json:"created_at"`        // Время завершения запуска (UTC)
+	Object    string            `json:"object"`            // Ключ объекта; каталог оканчивается на "/"
+	Size      int64             `json:"size"`              // Размер объекта (для каталога - сумма размеров)
+	Objects   []string          `json:"objects"`           // Все объекты запуска
+	Details   map[string]string `json:"details,omitempty"` // Сведения, специфичные для типа
+}
+
+// runIndex перечисляет объекты и манифесты запуска; записывается последним, после всех манифестов
+type runIndex struct {
+	CreatedAt time.Time `json:"created_at"`
+	Objects   []string  `json:"objects"`
+	Manifests []string  `json:"manifests"`
+}
+
+// manifestKey возвращает ключ манифеста объекта
+func manifestKey(key string) string {
+	return strings.TrimSuffix(key, "/") + manifestSuffix
+}
+
+// runIndexKey возвращает ключ индекса запуска относительно проекта
+func runIndexKey(backupItem config.ConfigBackup, createdAt time.Time) string {
+	return path.Join(backupItem.ObjectPath(), runIndexDir, createdAt.UTC().Format(runIndexLayout)+".json")
+}
+
+// runSize возвращает общий размер объектов запуска
+func runSize(ctx context.Context, bucketName string, keys []string) (int64, error) {
+	var total int64
+	for _, key := range keys {
+		size, err := objectSize(ctx, bucketName, key)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// writeManifests записывает манифесты объектов запуска, завершенного в createdAt, и индекс запуска
+func writeManifests(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string, keys []string, details map[string]string, createdAt time.Time) error {
+	index := runIndex{CreatedAt: createdAt, Objects: keys}
+	for _, key := range keys {
+		size, err := objectSize(ctx, bucketName, key)
+		if err != nil {
+			return err
+		}
+		manifest := Manifest{
+			Backup:    backupItem.Name,
+			Type:      backupItem.Type,
+			CreatedAt: createdAt,
+			Object:    key,
+			Size:      size,
+			Objects:   keys,
+			Details:   details,
+		}
+		objectPath := strings.TrimPrefix(manifestKey(key), cfg.Project+"/")
+		if err := putJSON(ctx, cfg, bucketName, objectPath, manifest); err != nil {
+			return fmt.Errorf("manifest upload failed: %w", err)
+		}
+		index.Manifests = append(index.Manifests, manifestKey(key))
+	}
+
+	if err := putJSON(ctx, cfg, bucketName, runIndexKey(backupItem, createdAt), index); err != nil {
+		return fmt.Errorf("run index upload failed: %w", err)
+	}
+	return nil
+}
+
+// putJSON загружает значение в формате JSON по пути относительно проекта
+func putJSON(ctx context.Context, cfg *config.BackupConfig, bucketName, objectPath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return minio.UploadToMinio(ctx, minio.UploadParams{
+		Project:    cfg.Project,
+		BucketName: bucketName,
+		ObjectPath: objectPath,
+		Reader:     bytes.NewReader(data),
+		Size:       int64(len(data)),
+	})
+}
+
+// objectSize возвращает размер объекта или, для ключа с "/" на конце, всех объектов каталога
+func objectSize(ctx context.Context, bucketName, key string) (int64, error) {
+	if !strings.HasSuffix(key, "/") {
+		info, err := minio.StatObject(ctx, bucketName, key, nil)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size, nil
+	}
+
+	objects, err := minio.ListObjects(ctx, bucketName, key)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, object := range objects {
+		size += object.Size
+	}
+	return size, nil
+}
+
+// backupRun - запуск бэкапа, найденный по индексу
+type backupRun struct {
+	CreatedAt time.Time
+	Index     string // Полный ключ индекса запуска
+}
+
+// PruneRuns удаляет запуски бэкапа сверх retention.keep и старше retention.keep-for.
+// Запуски берутся из списка индексов, читаются только индексы удаляемых запусков. Поэтому
+// WAL-сегменты, binlog-файлы и другие объекты без индекса в пути бэкапа не затрагиваются;
+// запуск, созданный в current, не удаляется.
+func PruneRuns(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string, current time.Time) error {
+	if !backupItem.Retention.Enabled() {
+		return nil
+	}
+
+	indexPrefix := minio.ObjectPrefix(cfg.Project, path.Join(backupItem.ObjectPath(), runIndexDir))
+	objects, err := minio.ListObjects(ctx, bucketName, indexPrefix)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+	for _, run := range expiredRuns(listRuns(objects, indexPrefix), backupItem.Retention, time.Now(), current) {
+		index, err := readRunIndex(ctx, bucketName, run.Index)
+		if err != nil {
+			// Запуск с нечитаемым индексом не удаляется
+			logger.Warn("skipping unreadable run index", "object", run.Index, "error", err)
+			continue
+		}
+
+		var keys []string
+		for _, key := range index.Objects {
+			if !strings.HasSuffix(key, "/") {
+				keys = append(keys, key)
+				continue
+			}
+			// Каталог, который записал сервер (ClickHouse BACKUP)
+			contents, err := minio.ListObjects(ctx, bucketName, key)
+			if err != nil {
+				return err
+			}
+			for _, object := range contents {
+				keys = append(keys, object.Key)
+			}
+		}
+		// Манифесты и индекс удаляются последними, чтобы прерванное удаление повторилось при следующем запуске
+		if err := minio.RemoveObjects(ctx, bucketName, keys); err != nil {
+			return err
+		}
+		if err := minio.RemoveObjects(ctx, bucketName, append(index.Manifests, run.Index)); err != nil {
+			return err
+		}
+		logger.Info("old backup deleted", "created_at", run.CreatedAt.Format(time.RFC3339), "objects", len(keys))
+	}
+	return nil
+}
+
+// listRuns восстанавливает запуски по именам индексов; новые запуски первыми
+func listRuns(objects []minio.ObjectInfo, indexPrefix string) []backupRun {
+	var runs []backupRun
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, indexPrefix)
+		createdAt, err := time.Parse(runIndexLayout, strings.TrimSuffix(name, ".json"))
+		if err != nil || strings.Contains(name, "/") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		runs = append(runs, backupRun{CreatedAt: createdAt, Index: object.Key})
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	return runs
+}
+
+// readRunIndex читает индекс запуска из бакета
+func readRunIndex(ctx context.Context, bucketName, key string) (runIndex, error) {
+	object, err := minio.OpenObject(ctx, bucketName, key)
+	if err != nil {
+		return runIndex{}, err
+	}
+	defer object.Close()
+
+	var index runIndex
+	if err := json.NewDecoder(object).Decode(&index); err != nil {
+		return runIndex{}, fmt.Errorf("invalid run index %s: %w", key, err)
+	}
+	return index, nil
+}
+
+// expiredRuns выбирает запуски для удаления так же, как elasticsearch.keep и keep-for
+func expiredRuns(runs []backupRun, retention config.Retention, now, current time.Time) []backupRun {
+	var expired []backupRun
+	for i, run := range runs {
+		if run.CreatedAt.Equal(current) {
+			continue
+		}
+		old := retention.KeepFor > 0 && now.Sub(run.CreatedAt) > retention.KeepFor
+		excess := retention.Keep > 0 && i >= retention.Keep
+		if old || excess {
+			expired = append(expired, run)
+		}
+	}
+	return expired
+}
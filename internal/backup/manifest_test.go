@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/minio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionSelectsWholeRuns(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	const indexPrefix = "p/ch/.runs/"
+	index := func(daysAgo int) minio.ObjectInfo {
+		return minio.ObjectInfo{Key: indexPrefix + now.AddDate(0, 0, -daysAgo).Format(runIndexLayout) + ".json"}
+	}
+	objects := []minio.ObjectInfo{
+		index(3),
+		index(0),
+		// Посторонние объекты в каталоге индексов не считаются запусками
+		{Key: indexPrefix + "notes.txt"},
+		{Key: indexPrefix + "old/2024-05-01T00-00-00Z.json"},
+		index(1),
+		index(2),
+	}
+
+	runs := listRuns(objects, indexPrefix)
+	if len(runs) != 4 || !runs[0].CreatedAt.Equal(now) {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	if runs[3].Index != "p/ch/.runs/2024-05-07T12-00-00Z.json" {
+		t.Errorf("index of the oldest run = %s", runs[3].Index)
+	}
+
+	createdAt := func(runs []backupRun) string {
+		var days []string
+		for _, run := range runs {
+			days = append(days, run.CreatedAt.Format("01-02"))
+		}
+		return strings.Join(days, ",")
+	}
+	tests := []struct {
+		name      string
+		retention config.Retention
+		current   time.Time
+		want      string
+	}{
+		{name: "keep", retention: config.Retention{Keep: 2}, current: now, want: "05-08,05-07"},
+		{name: "keep-for", retention: config.Retention{KeepFor: 36 * time.Hour}, current: now, want: "05-08,05-07"},
+		{name: "both", retention: config.Retention{Keep: 3, KeepFor: 60 * time.Hour}, current: now, want: "05-07"},
+		{name: "current run is kept", retention: config.Retention{Keep: 1}, current: now.AddDate(0, 0, -2), want: "05-09,05-07"},
+		{name: "nothing expired", retention: config.Retention{Keep: 10}, current: now, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := createdAt(expiredRuns(runs, tt.retention, now, tt.current)); got != tt.want {
+				t.Errorf("expiredRuns() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestsOnlyWithRetention(t *testing.T) {
+	tests := []struct {
+		item config.ConfigBackup
+		want bool
+	}{
+		{item: config.ConfigBackup{Type: "folder"}, want: false},
+		{item: config.ConfigBackup{Type: "etcd", Retention: config.Retention{Keep: 28}}, want: true},
+		{item: config.ConfigBackup{Type: "postgres", Retention: config.Retention{KeepFor: time.Hour}}, want: true},
+		{item: config.ConfigBackup{Type: "s3", Retention: config.Retention{Keep: 1}}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.item.HasManifests(); got != tt.want {
+			t.Errorf("HasManifests(%s, %+v) = %v, want %v", tt.item.Type, tt.item.Retention, got, tt.want)
+		}
+	}
+}
@@ -1,127 +1,269 @@
 package backup
 
 import (
-	"bytes"
+	"backup-to-minio/internal/config"
+	"context"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Схемы строк подключения MongoDB
+const (
+	mongoScheme    = "mongodb://"
+	mongoSRVScheme = "mongodb+srv://"
 )
 
+// mongoAuthMechanisms - механизмы аутентификации, которые поддерживает mongodump
+var mongoAuthMechanisms = []string{"SCRAM-SHA-1", "SCRAM-SHA-256", "MONGODB-X509", "MONGODB-AWS", "GSSAPI", "PLAIN"}
+
 // MongoDBParams содержит параметры подключения к MongoDB
 type MongoDBParams struct {
-	URI        string
-	Host       string
-	Port       string
+	URI        string   // Полная строка подключения со схемой
+	SRV        bool     // Строка вида mongodb+srv:// (хосты определяются через DNS)
+	Hosts      []string // Хосты в формате host:port (для SRV - имя без порта)
 	DBName     string
 	Username   string
 	Password   string
 	AuthDB     string
+	ReplicaSet string
+	TLS        bool
 }
 
-// parseMongoConnString парсит строку подключения MongoDB
+// parseMongoConnString разбирает и проверяет строку подключения MongoDB.
+// Поддерживаются mongodb:// со списком хостов через запятую и mongodb+srv://;
+// строка без схемы считается mongodb://. URI остается без изменений, кроме добавленной схемы.
 func parseMongoConnString(connString string) (*MongoDBParams, error) {
-	// Удаляем префикс mongodb:// при наличии
-	connString = strings.TrimPrefix(connString, "mongodb://")
+	params := &MongoDBParams{}
+
+	var rest string
+	switch {
+	case strings.HasPrefix(connString, mongoSRVScheme):
+		params.SRV = true
+		rest = strings.TrimPrefix(connString, mongoSRVScheme)
+	case strings.HasPrefix(connString, mongoScheme):
+		rest = strings.TrimPrefix(connString, mongoScheme)
+	case strings.Contains(connString, "://"):
+		return nil, fmt.Errorf("unsupported MongoDB connection string scheme")
+	default:
+		rest = connString
+		connString = mongoScheme + connString
+	}
+	params.URI = connString
+
+	// Разделяем authority ([user:pass@]host1,host2) и /db?options
+	authority, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		authority, tail = rest[:i], rest[i:]
+	}
+
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userInfo := authority[:i]
+		authority = authority[i+1:]
+
+		user, password, _ := strings.Cut(userInfo, ":")
+		var err error
+		if params.Username, err = url.PathUnescape(user); err != nil {
+			return nil, fmt.Errorf("invalid MongoDB username: %w", err)
+		}
+		if params.Password, err = url.PathUnescape(password); err != nil {
+			return nil, fmt.Errorf("invalid MongoDB password: %w", err)
+		}
+	}
+
+	if authority == "" {
+		return nil, fmt.Errorf("MongoDB connection string has no hosts")
+	}
+	for _, host := range strings.Split(authority, ",") {
+		normalized, err := normalizeMongoHost(host, params.SRV)
+		if err != nil {
+			return nil, err
+		}
+		params.Hosts = append(params.Hosts, normalized)
+	}
+	if params.SRV && len(params.Hosts) != 1 {
+		return nil, fmt.Errorf("mongodb+srv connection string must have exactly one host")
+	}
 
-	u, err := url.Parse(connString)
+	// База и параметры; перед параметрами спецификация требует "/"
+	path, rawQuery, hasQuery := strings.Cut(tail, "?")
+	if hasQuery && path == "" {
+		return nil, fmt.Errorf("MongoDB connection string options must follow \"/\"")
+	}
+	dbName, err := url.PathUnescape(strings.TrimPrefix(path, "/"))
 	if err != nil {
-		return nil, fmt.Errorf("invalid MongoDB connection string: %w", err)
+		return nil, fmt.Errorf("invalid MongoDB database name: %w", err)
+	}
+	if strings.ContainsAny(dbName, "/\\. \"$") {
+		return nil, fmt.Errorf("invalid MongoDB database name: %q", dbName)
+	}
+	params.DBName = dbName
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MongoDB connection options: %w", err)
+	}
+	if err := params.applyOptions(query); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+// normalizeMongoHost проверяет хост и добавляет порт по умолчанию
+func normalizeMongoHost(host string, srv bool) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("MongoDB connection string has an empty host")
+	}
+	hostname, port := host, ""
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		var err error
+		if hostname, port, err = net.SplitHostPort(host); err != nil {
+			if !strings.HasSuffix(host, "]") {
+				return "", fmt.Errorf("invalid MongoDB host %q: %w", host, err)
+			}
+			hostname = strings.Trim(host, "[]")
+		}
+	}
+	if hostname == "" {
+		return "", fmt.Errorf("invalid MongoDB host %q", host)
+	}
+
+	if srv {
+		if port != "" {
+			return "", fmt.Errorf("mongodb+srv host must not have a port")
+		}
+		return hostname, nil
 	}
 
-	password, _ := u.User.Password()
-	host, port := u.Hostname(), u.Port()
 	if port == "" {
 		port = "27017"
 	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid MongoDB port in host %q", host)
+	}
+	return net.JoinHostPort(hostname, port), nil
+}
+
+// applyOptions проверяет параметры строки подключения, которые влияют на подключение
+func (p *MongoDBParams) applyOptions(query url.Values) error {
+	// Имена параметров нечувствительны к регистру
+	options := make(map[string]string, len(query))
+	for key, values := range query {
+		options[strings.ToLower(key)] = values[len(values)-1]
+	}
+
+	// Для SRV TLS включен по умолчанию
+	p.TLS = p.SRV
+	for _, key := range []string{"tls", "ssl"} {
+		if value, ok := options[key]; ok {
+			if value != "true" && value != "false" {
+				return fmt.Errorf("invalid MongoDB option %s=%s: expected true or false", key, value)
+			}
+			p.TLS = value == "true"
+		}
+	}
+	if tls, ssl := options["tls"], options["ssl"]; tls != "" && ssl != "" && tls != ssl {
+		return fmt.Errorf("MongoDB options tls and ssl conflict")
+	}
 
-	dbName := strings.TrimPrefix(u.Path, "/")
-	if strings.Contains(dbName, "/") {
-		dbName = strings.Split(dbName, "/")[0]
+	if value, ok := options["replicaset"]; ok {
+		if value == "" {
+			return fmt.Errorf("MongoDB option replicaSet must not be empty")
+		}
+		p.ReplicaSet = value
 	}
 
-	query := u.Query()
-	authDB := query.Get("authSource")
+	if value, ok := options["authmechanism"]; ok && !slices.Contains(mongoAuthMechanisms, value) {
+		return fmt.Errorf("unsupported MongoDB authMechanism: %s", value)
+	}
+
+	if options["directconnection"] == "true" && len(p.Hosts) > 1 {
+		return fmt.Errorf("MongoDB directConnection requires a single host")
+	}
+	if options["directconnection"] == "true" && p.SRV {
+		return fmt.Errorf("MongoDB directConnection cannot be used with mongodb+srv")
+	}
 
-	return &MongoDBParams{
-		URI:      connString,
-		Host:     host,
-		Port:     port,
-		DBName:   dbName,
-		Username: u.User.Username(),
-		Password: password,
-		AuthDB:   authDB,
-	}, nil
+	p.AuthDB = options["authsource"]
+	return nil
 }
 
-// BackupMongoDB выполняет резервное копирование MongoDB
-func BackupMongoDB(connString, outputDir string) (string, error) {
-	params, err := parseMongoConnString(connString)
+// BackupMongoDB выполняет резервное копирование MongoDB в режиме mongodump --archive --gzip.
+// Архив не сохраняется на диск, а передается из stdout mongodump прямо в upload.
+// Без базы в строке подключения выгружаются все базы; полная строка подключения
+// (несколько хостов, replicaSet, TLS) передается mongodump без изменений.
+func BackupMongoDB(ctx context.Context, backupItem config.ConfigBackup, outputDir string, upload streamUploader) (string, error) {
+	params, err := parseMongoConnString(backupItem.Source)
 	if err != nil {
 		return "", fmt.Errorf("MongoDB connection error: %w", err)
 	}
 
-	if params.DBName == "" {
-		return "", fmt.Errorf("database name is required")
+	opts := backupItem.MongoDB
+	if params.DBName == "" && (opts.Collection != "" || len(opts.ExcludeCollections) > 0) {
+		return "", fmt.Errorf("collection filters require a database in the connection string")
+	}
+	if params.DBName != "" && opts.Oplog {
+		return "", fmt.Errorf("oplog requires a connection string without a database")
 	}
 
-	// Генерируем имя файла
+	// Генерируем имя архива
+	name := params.DBName
+	if name == "" {
+		name = backupItem.Name
+	}
 	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
-	dumpDir := filepath.Join(outputDir, fmt.Sprintf("%s-%s", params.DBName, timestamp))
-	archiveName := dumpDir + ".gz"
+	archiveName := fmt.Sprintf("%s-%s.archive.gz", name, timestamp)
+
+	// Строка подключения с паролем передается через файл конфигурации, а не через argv,
+	// где ее видно в списке процессов
+	configPath, err := writeMongoConfig(params, outputDir)
+	if err != nil {
+		return "", err
+	}
 
 	// Формируем команду mongodump
 	cmdArgs := []string{
-		"--host", params.Host + ":" + params.Port,
-		"--db", params.DBName,
-		"--out", dumpDir,
+		"--config", configPath,
+		"--archive",
+		"--gzip",
 	}
-
-	if params.Username != "" {
-		cmdArgs = append(cmdArgs, "--username", params.Username)
+	if opts.Oplog {
+		cmdArgs = append(cmdArgs, "--oplog")
 	}
-	if params.Password != "" {
-		cmdArgs = append(cmdArgs, "--password", params.Password)
+	if opts.ReadPreference != "" {
+		cmdArgs = append(cmdArgs, "--readPreference", opts.ReadPreference)
 	}
-	if params.AuthDB != "" {
-		cmdArgs = append(cmdArgs, "--authenticationDatabase", params.AuthDB)
+	if opts.Collection != "" {
+		cmdArgs = append(cmdArgs, "--collection", opts.Collection)
 	}
-
-	cmd := exec.Command("mongodump", cmdArgs...)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	// Выполняем команду
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("mongodump failed: %v\nError: %s", err, stderr.String())
+	for _, collection := range opts.ExcludeCollections {
+		cmdArgs = append(cmdArgs, "--excludeCollection", collection)
 	}
 
-	// Сжимаем результат
-	if err := GzCompressDir(dumpDir, archiveName); err != nil {
-		return "", fmt.Errorf("compression failed: %w", err)
-	}
+	cmd := exec.CommandContext(ctx, "mongodump", cmdArgs...)
+	return streamTool(ctx, cmd, archiveName, upload)
+}
 
-	// Удаляем временную директорию
-	if err := os.RemoveAll(dumpDir); err != nil {
-		fmt.Printf("Warning: failed to remove temp directory %s: %v\n", dumpDir, err)
+// writeMongoConfig записывает файл конфигурации mongodump со строкой подключения
+func writeMongoConfig(params *MongoDBParams, outputDir string) (string, error) {
+	data, err := yaml.Marshal(map[string]string{"uri": params.URI})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode mongodump config: %w", err)
 	}
 
-	return archiveName, nil
-}
-
-// GzCompressDir сжимает директорию в .tar.gz
-func GzCompressDir(source, target string) error {
-	cmd := exec.Command("tar", "-czf", target, "-C", filepath.Dir(source), filepath.Base(source))
-	
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("tar compression failed: %v\nError: %s", err, stderr.String())
+	configPath := filepath.Join(outputDir, "mongodump.yml")
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write mongodump config: %w", err)
 	}
-	return nil
-}
\ No newline at end of file
+	return configPath, nil
+}
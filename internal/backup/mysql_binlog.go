@@ -0,0 +1,286 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BinlogIndexName - имя объекта с индексом архивированных binlog-файлов
+const BinlogIndexName = "binlog-index.json"
+
+// binlogMagic - сигнатура в начале binlog-файла
+var binlogMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+// BinlogFile описывает архивированный binlog-файл
+type BinlogFile struct {
+	Name        string    `json:"file"`         // Имя binlog-файла на сервере
+	Object      string    `json:"object"`       // Имя объекта в бакете относительно префикса бэкапа
+	StartTime   time.Time `json:"start_time"`   // Время создания файла (первое событие)
+	EndPosition int64     `json:"end_position"` // Позиция конца файла (размер на сервере)
+	ArchivedAt  time.Time `json:"archived_at"`  // Время загрузки в бакет
+}
+
+// BinlogPosition - позиция в binlog, с которой продолжается применение событий после дампа
+type BinlogPosition struct {
+	File     string
+	Position int64
+}
+
+// binlogPositionPattern соответствует позиции, которую mysqldump --source-data=2 (или --master-data=2)
+// и встроенный дампер записывают в заголовок дампа
+var binlogPositionPattern = regexp.MustCompile(`^-- CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=(\d+);`)
+
+// binlogPositionScanLines - сколько строк заголовка дампа просматривается в поисках позиции
+const binlogPositionScanLines = 100
+
+// ChangeSourceStatement возвращает позицию в виде оператора CHANGE MASTER TO, как ее записывает mysqldump
+func (p BinlogPosition) ChangeSourceStatement() string {
+	return fmt.Sprintf("CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%d;", p.File, p.Position)
+}
+
+// readBinlogPosition ищет позицию binlog в заголовке SQL-дампа; nil, если ее там нет
+func readBinlogPosition(r io.Reader) (*BinlogPosition, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for i := 0; i < binlogPositionScanLines && scanner.Scan(); i++ {
+		match := binlogPositionPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		position, err := strconv.ParseInt(match[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid binlog position: %w", err)
+		}
+		return &BinlogPosition{File: match[1], Position: position}, nil
+	}
+	// Строка длиннее буфера может встретиться только в данных, после заголовка
+	if err := scanner.Err(); err != nil && !errors.Is(err, bufio.ErrTooLong) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// BinlogIndex содержит список архивированных binlog-файлов в порядке их создания
+type BinlogIndex struct {
+	Files []BinlogFile `json:"files"`
+}
+
+// binaryLog описывает binlog-файл из SHOW BINARY LOGS
+type binaryLog struct {
+	Name string
+	Size int64
+}
+
+// BackupMySQLBinlog закрывает текущий binlog (FLUSH BINARY LOGS), скачивает еще не загруженные
+// закрытые файлы с помощью mysqlbinlog и обновляет индекс с их позициями.
+// Возвращает сжатые binlog-файлы и индекс; индекс идет последним, чтобы загружаться после файлов.
+func BackupMySQLBinlog(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName, outputDir string) ([]string, error) {
+	params, err := parseMySQLConnString(backupItem.Source)
+	if err != nil {
+		return nil, fmt.Errorf("connection string parse error: %w", err)
+	}
+
+	logs, err := rotateBinaryLogs(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := minio.ObjectPrefix(cfg.Project, backupItem.ObjectPath())
+	index, err := LoadBinlogIndex(ctx, bucketName, prefix, outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string]bool, len(index.Files))
+	for _, file := range index.Files {
+		archived[file.Name] = true
+	}
+
+	// Последний файл открыт сервером для записи и будет загружен после следующей ротации
+	var pending []binaryLog
+	for _, log := range logs[:len(logs)-1] {
+		if !archived[log.Name] {
+			pending = append(pending, log)
+		}
+	}
+
+	logger := logging.FromContext(ctx)
+	if len(pending) == 0 {
+		logger.Info("no new binlog files to archive")
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(pending))
+	for _, log := range pending {
+		names = append(names, log.Name)
+	}
+	if err := fetchBinlogs(ctx, params, names, outputDir); err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(pending)+1)
+	now := time.Now().UTC()
+	for _, log := range pending {
+		rawPath := filepath.Join(outputDir, log.Name)
+		startTime, err := binlogStartTime(rawPath)
+		if err != nil {
+			return nil, fmt.Errorf("binlog %s: %w", log.Name, err)
+		}
+
+		archiveName, err := GzFile(rawPath)
+		if err != nil {
+			return nil, fmt.Errorf("compression failed: %w", err)
+		}
+		if err := os.Remove(rawPath); err != nil {
+			logger.Warn("failed to remove temp file", "path", rawPath, "error", err)
+		}
+
+		files = append(files, archiveName)
+		index.Files = append(index.Files, BinlogFile{
+			Name:        log.Name,
+			Object:      filepath.Base(archiveName),
+			StartTime:   startTime,
+			EndPosition: log.Size,
+			ArchivedAt:  now,
+		})
+	}
+
+	sort.SliceStable(index.Files, func(i, j int) bool {
+		return index.Files[i].StartTime.Before(index.Files[j].StartTime)
+	})
+
+	indexPath := filepath.Join(outputDir, BinlogIndexName)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode binlog index: %w", err)
+	}
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write binlog index: %w", err)
+	}
+
+	logger.Info("binlog files fetched", "files", len(pending), "last", pending[len(pending)-1].Name)
+	return append(files, indexPath), nil
+}
+
+// LoadBinlogIndex скачивает индекс binlog-файлов; если индекса еще нет, возвращается пустой индекс
+func LoadBinlogIndex(ctx context.Context, bucketName, prefix, tmpDir string) (*BinlogIndex, error) {
+	indexPath := filepath.Join(tmpDir, BinlogIndexName+".remote")
+	err := minio.DownloadObject(ctx, bucketName, path.Join(prefix, BinlogIndexName), indexPath, nil)
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return &BinlogIndex{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download binlog index: %w", err)
+	}
+	defer os.Remove(indexPath)
+
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read binlog index: %w", err)
+	}
+	var index BinlogIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid binlog index: %w", err)
+	}
+	return &index, nil
+}
+
+// rotateBinaryLogs закрывает текущий binlog-файл и возвращает список файлов сервера
+func rotateBinaryLogs(ctx context.Context, params *MySQLParams) ([]binaryLog, error) {
+	db, err := sql.Open("mysql", params.dsn())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "FLUSH BINARY LOGS"); err != nil {
+		return nil, fmt.Errorf("failed to rotate binary logs: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SHOW BINARY LOGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list binary logs: %w", err)
+	}
+	defer rows.Close()
+
+	// Набор колонок зависит от версии сервера (Encrypted появилась в 8.0)
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list binary logs: %w", err)
+	}
+
+	var logs []binaryLog
+	for rows.Next() {
+		var log binaryLog
+		dest := make([]any, len(columns))
+		for i := range dest {
+			dest[i] = new(sql.RawBytes)
+		}
+		dest[0], dest[1] = &log.Name, &log.Size
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to list binary logs: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list binary logs: %w", err)
+	}
+	if len(logs) == 0 {
+		return nil, fmt.Errorf("binary logging is disabled on the server")
+	}
+	return logs, nil
+}
+
+// fetchBinlogs скачивает binlog-файлы с сервера без преобразования в outputDir
+func fetchBinlogs(ctx context.Context, params *MySQLParams, names []string, outputDir string) error {
+	args := []string{
+		"--read-from-remote-server",
+		"--raw",
+		"--host=" + params.Host,
+		"--port=" + params.Port,
+		"--user=" + params.User,
+		"--password=" + params.Password,
+		// В режиме --raw значение используется как префикс имен файлов
+		"--result-file=" + outputDir + string(filepath.Separator),
+	}
+	args = append(args, names...)
+
+	cmd := exec.CommandContext(ctx, "mysqlbinlog", args...)
+	return runTool(ctx, cmd)
+}
+
+// binlogStartTime возвращает время первого события binlog-файла (Format Description Event)
+func binlogStartTime(filePath string) (time.Time, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read header: %w", err)
+	}
+	if !bytes.Equal(header[:4], binlogMagic) {
+		return time.Time{}, fmt.Errorf("not a binlog file")
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint32(header[4:])), 0).UTC(), nil
+}
@@ -0,0 +1,546 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Драйверы резервного копирования MySQL
+const (
+	MySQLDriverMysqldump = "mysqldump" // Внешняя утилита mysqldump (по умолчанию)
+	MySQLDriverNative    = "native"    // Встроенный дампер на Go без внешних утилит
+)
+
+// nativeInsertSize - примерный максимальный размер одного INSERT в байтах
+const nativeInsertSize = 1 << 20
+
+// Типы колонок, значения которых выгружаются без кавычек
+var mysqlNumericTypes = map[string]bool{
+	"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "BIGINT": true,
+	"DECIMAL": true, "FLOAT": true, "DOUBLE": true, "YEAR": true,
+}
+
+// Типы колонок, значения которых выгружаются в шестнадцатеричном виде
+var mysqlBinaryTypes = map[string]bool{
+	"BLOB": true, "TINYBLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"BINARY": true, "VARBINARY": true, "BIT": true, "GEOMETRY": true,
+}
+
+const nativeDumpHeader = `-- backup-to-minio native MySQL dump
+-- Database: %s
+-- Server version: %s
+
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!40101 SET @OLD_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS */;
+/*!40101 SET @OLD_COLLATION_CONNECTION=@@COLLATION_CONNECTION */;
+/*!40101 SET NAMES utf8mb4 */;
+/*!40103 SET @OLD_TIME_ZONE=@@TIME_ZONE */;
+/*!40103 SET TIME_ZONE='+00:00' */;
+/*!40014 SET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0 */;
+/*!40014 SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0 */;
+/*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
+/*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
+`
+
+const nativeDumpFooter = `
+/*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
+/*!40101 SET SQL_MODE=@OLD_SQL_MODE */;
+/*!40014 SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS */;
+/*!40014 SET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS */;
+/*!40101 SET CHARACTER_SET_CLIENT=@OLD_CHARACTER_SET_CLIENT */;
+/*!40101 SET CHARACTER_SET_RESULTS=@OLD_CHARACTER_SET_RESULTS */;
+/*!40101 SET COLLATION_CONNECTION=@OLD_COLLATION_CONNECTION */;
+/*!40111 SET SQL_NOTES=@OLD_SQL_NOTES */;
+
+-- Dump completed on %s
+`
+
+// dumpMySQLNative выгружает базу средствами Go и загружает дамп, сжатый gzip, в бакет
+// как <база>-<timestamp>.sql.gz без промежуточного файла. Возвращает полный ключ объекта.
+// Как и mysqldump --single-transaction, все данные читаются в одной транзакции с согласованным снимком.
+func dumpMySQLNative(ctx context.Context, params *MySQLParams, dbName string, binlogPosition bool, upload streamUploader) (string, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = params.User
+	cfg.Passwd = params.Password
+	cfg.Net = "tcp"
+	cfg.Addr = params.addr()
+	cfg.DBName = dbName
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	defer db.Close()
+
+	return streamMySQLDump(ctx, db, dbName, binlogPosition, upload)
+}
+
+// streamMySQLDump записывает дамп базы в поток загрузки
+func streamMySQLDump(ctx context.Context, db *sql.DB, dbName string, binlogPosition bool, upload streamUploader) (string, error) {
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	name := fmt.Sprintf("%s-%s.sql.gz", dbName, timestamp)
+	return streamGzip(ctx, name, upload, func(w io.Writer) error {
+		bw := bufio.NewWriterSize(w, 256<<10)
+		if err := dumpMySQLDatabaseTo(ctx, db, dbName, binlogPosition, bw); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// dumpMySQLDatabaseTo записывает SQL-дамп базы в w.
+// С binlogPosition в заголовок записывается позиция binlog, соответствующая снимку данных.
+func dumpMySQLDatabaseTo(ctx context.Context, db *sql.DB, dbName string, binlogPosition bool, w io.Writer) error {
+	// Все запросы выполняются в одном соединении, чтобы транзакция видела согласованный снимок
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	defer conn.Close()
+
+	// Как и mysqldump, TIMESTAMP выгружаются в UTC: заголовок дампа задает TIME_ZONE='+00:00'
+	// при загрузке, поэтому значения в часовом поясе сервера сдвинулись бы при восстановлении
+	if _, err := conn.ExecContext(ctx, "SET time_zone='+00:00'"); err != nil {
+		return fmt.Errorf("failed to set time zone: %w", err)
+	}
+
+	position, err := startMySQLSnapshot(ctx, conn, binlogPosition)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	var serverVersion string
+	if err := conn.QueryRowContext(ctx, "SELECT VERSION()").Scan(&serverVersion); err != nil {
+		return fmt.Errorf("failed to get server version: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, nativeDumpHeader, dbName, serverVersion); err != nil {
+		return err
+	}
+	if position != nil {
+		if _, err := fmt.Fprintf(w, "\n-- Position to start replication or point-in-time recovery from\n\n-- %s\n", position.ChangeSourceStatement()); err != nil {
+			return err
+		}
+	}
+
+	tables, views, err := listMySQLTables(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := dumpMySQLTable(ctx, conn, table, w); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+
+	// Представления могут ссылаться друг на друга, поэтому, как и mysqldump, сначала создаются
+	// заглушки с теми же колонками, а настоящие определения записываются в конце дампа
+	for _, view := range views {
+		if err := dumpMySQLViewStandIn(ctx, conn, view, w); err != nil {
+			return fmt.Errorf("view %s: %w", view, err)
+		}
+	}
+
+	if err := dumpMySQLTriggers(ctx, conn, w); err != nil {
+		return err
+	}
+	if err := dumpMySQLRoutines(ctx, conn, dbName, w); err != nil {
+		return err
+	}
+
+	for _, view := range views {
+		var name, createSQL, charset, collation string
+		if err := conn.QueryRowContext(ctx, "SHOW CREATE VIEW "+quoteIdent(view)).Scan(&name, &createSQL, &charset, &collation); err != nil {
+			return fmt.Errorf("view %s: %w", view, err)
+		}
+		if _, err := fmt.Fprintf(w, "\n--\n-- View structure for %s\n--\n\nDROP VIEW IF EXISTS %s;\n%s;\n", quoteIdent(view), quoteIdent(view), createSQL); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, nativeDumpFooter, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// startMySQLSnapshot открывает транзакцию с согласованным снимком и, если нужно, возвращает
+// позицию binlog на момент снимка. Как и mysqldump --single-transaction --source-data, снимок и
+// позиция берутся под кратковременной глобальной блокировкой, иначе между ними могут пройти транзакции.
+func startMySQLSnapshot(ctx context.Context, conn *sql.Conn, binlogPosition bool) (*BinlogPosition, error) {
+	if binlogPosition {
+		if _, err := conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+			return nil, fmt.Errorf("failed to lock tables: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "UNLOCK TABLES")
+	}
+
+	for _, query := range []string{
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+	} {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("failed to start transaction: %w", err)
+		}
+	}
+
+	if !binlogPosition {
+		return nil, nil
+	}
+	return showBinlogPosition(ctx, conn)
+}
+
+// showBinlogPosition возвращает текущую позицию binlog (SHOW MASTER STATUS,
+// в MySQL 8.4 - SHOW BINARY LOG STATUS)
+func showBinlogPosition(ctx context.Context, conn *sql.Conn) (*BinlogPosition, error) {
+	rows, err := conn.QueryContext(ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		if rows, err = conn.QueryContext(ctx, "SHOW BINARY LOG STATUS"); err != nil {
+			return nil, fmt.Errorf("failed to get binlog position: %w", err)
+		}
+	}
+	defer rows.Close()
+
+	// Набор колонок после File и Position зависит от версии сервера
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get binlog position: %w", err)
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get binlog position: %w", err)
+		}
+		return nil, fmt.Errorf("binary logging is disabled on the server")
+	}
+	var position BinlogPosition
+	dest := make([]any, len(columns))
+	for i := range dest {
+		dest[i] = new(sql.RawBytes)
+	}
+	dest[0], dest[1] = &position.File, &position.Position
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to get binlog position: %w", err)
+	}
+	return &position, nil
+}
+
+// listMySQLTables возвращает таблицы и представления текущей базы
+func listMySQLTables(ctx context.Context, conn *sql.Conn) ([]string, []string, error) {
+	rows, err := conn.QueryContext(ctx, "SHOW FULL TABLES")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables, views []string
+	for rows.Next() {
+		var name, tableType string
+		if err := rows.Scan(&name, &tableType); err != nil {
+			return nil, nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		if tableType == "VIEW" {
+			views = append(views, name)
+		} else {
+			tables = append(tables, name)
+		}
+	}
+	return tables, views, rows.Err()
+}
+
+// dumpMySQLTable записывает структуру и данные таблицы
+func dumpMySQLTable(ctx context.Context, conn *sql.Conn, table string, w io.Writer) error {
+	var name, createSQL string
+	if err := conn.QueryRowContext(ctx, "SHOW CREATE TABLE "+quoteIdent(table)).Scan(&name, &createSQL); err != nil {
+		return fmt.Errorf("failed to get table structure: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "\n--\n-- Table structure for %s\n--\n\nDROP TABLE IF EXISTS %s;\n%s;\n\n--\n-- Dumping data for %s\n--\n\nLOCK TABLES %s WRITE;\n/*!40000 ALTER TABLE %s DISABLE KEYS */;\n",
+		quoteIdent(table), quoteIdent(table), createSQL, quoteIdent(table), quoteIdent(table), quoteIdent(table)); err != nil {
+		return err
+	}
+
+	columns, err := mysqlTableColumns(ctx, conn, table)
+	if err != nil {
+		return fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	// Генерируемые колонки вычисляются сервером, и INSERT со значениями для них не выполнится
+	var names, types []string
+	for _, column := range columns {
+		if column.generated() {
+			continue
+		}
+		names = append(names, quoteIdent(column.Name))
+		types = append(types, column.Type)
+	}
+	if len(names) == 0 {
+		_, err = fmt.Fprintf(w, "/*!40000 ALTER TABLE %s ENABLE KEYS */;\nUNLOCK TABLES;\n", quoteIdent(table))
+		return err
+	}
+	columnList := strings.Join(names, ",")
+
+	rows, err := conn.QueryContext(ctx, "SELECT "+columnList+" FROM "+quoteIdent(table))
+	if err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(names))
+	ptrs := make([]any, len(names))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	// Строки объединяются в расширенные INSERT ограниченного размера
+	var stmt strings.Builder
+	flush := func() error {
+		if stmt.Len() == 0 {
+			return nil
+		}
+		stmt.WriteString(";\n")
+		_, err := io.WriteString(w, stmt.String())
+		stmt.Reset()
+		return err
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("failed to read row: %w", err)
+		}
+
+		if stmt.Len() == 0 {
+			stmt.WriteString("INSERT INTO " + quoteIdent(table) + " (" + columnList + ") VALUES (")
+		} else {
+			stmt.WriteString(",(")
+		}
+		for i, value := range values {
+			if i > 0 {
+				stmt.WriteByte(',')
+			}
+			writeMySQLValue(&stmt, types[i], value)
+		}
+		stmt.WriteByte(')')
+
+		if stmt.Len() >= nativeInsertSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "/*!40000 ALTER TABLE %s ENABLE KEYS */;\nUNLOCK TABLES;\n", quoteIdent(table))
+	return err
+}
+
+// mysqlColumn описывает колонку таблицы из information_schema
+type mysqlColumn struct {
+	Name  string
+	Type  string // DATA_TYPE в верхнем регистре (INT, VARCHAR, BLOB, ...)
+	Extra string
+}
+
+// generated сообщает, что значение колонки вычисляется сервером (VIRTUAL или STORED GENERATED).
+// DEFAULT_GENERATED означает лишь выражение по умолчанию, такие колонки выгружаются.
+func (c mysqlColumn) generated() bool {
+	extra := strings.ToUpper(c.Extra)
+	return strings.Contains(extra, "GENERATED") && !strings.Contains(extra, "DEFAULT_GENERATED")
+}
+
+// mysqlTableColumns возвращает колонки таблицы или представления в порядке их объявления
+func mysqlTableColumns(ctx context.Context, conn *sql.Conn, table string) ([]mysqlColumn, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT COLUMN_NAME, DATA_TYPE, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []mysqlColumn
+	for rows.Next() {
+		var column mysqlColumn
+		if err := rows.Scan(&column.Name, &column.Type, &column.Extra); err != nil {
+			return nil, err
+		}
+		column.Type = strings.ToUpper(column.Type)
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns found")
+	}
+	return columns, nil
+}
+
+// dumpMySQLViewStandIn записывает временное представление с колонками настоящего,
+// чтобы представления, ссылающиеся на него, создавались независимо от порядка
+func dumpMySQLViewStandIn(ctx context.Context, conn *sql.Conn, view string, w io.Writer) error {
+	columns, err := mysqlTableColumns(ctx, conn, view)
+	if err != nil {
+		return fmt.Errorf("failed to read columns: %w", err)
+	}
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = "1 AS " + quoteIdent(column.Name)
+	}
+	_, err = fmt.Fprintf(w, "\n--\n-- Temporary view structure for %s\n--\n\nDROP TABLE IF EXISTS %s;\nDROP VIEW IF EXISTS %s;\nCREATE VIEW %s AS SELECT %s;\n",
+		quoteIdent(view), quoteIdent(view), quoteIdent(view), quoteIdent(view), strings.Join(fields, ", "))
+	return err
+}
+
+// dumpMySQLTriggers записывает триггеры текущей базы
+func dumpMySQLTriggers(ctx context.Context, conn *sql.Conn, w io.Writer) error {
+	names, err := queryStrings(ctx, conn, "SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = DATABASE()")
+	if err != nil {
+		return fmt.Errorf("failed to list triggers: %w", err)
+	}
+
+	for _, name := range names {
+		createSQL, err := showCreate(ctx, conn, "SHOW CREATE TRIGGER "+quoteIdent(name), "SQL Original Statement")
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", name, err)
+		}
+		if _, err := fmt.Fprintf(w, "\nDROP TRIGGER IF EXISTS %s;\nDELIMITER ;;\n%s;;\nDELIMITER ;\n", quoteIdent(name), createSQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpMySQLRoutines записывает хранимые процедуры и функции базы
+func dumpMySQLRoutines(ctx context.Context, conn *sql.Conn, dbName string, w io.Writer) error {
+	for _, kind := range []string{"PROCEDURE", "FUNCTION"} {
+		names, err := queryStrings(ctx, conn, "SELECT ROUTINE_NAME FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_TYPE = ?", dbName, kind)
+		if err != nil {
+			return fmt.Errorf("failed to list routines: %w", err)
+		}
+
+		for _, name := range names {
+			column := "Create " + strings.ToLower(kind)
+			column = strings.ToUpper(column[:1]) + column[1:]
+			createSQL, err := showCreate(ctx, conn, "SHOW CREATE "+kind+" "+quoteIdent(name), column)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", strings.ToLower(kind), name, err)
+			}
+			if _, err := fmt.Fprintf(w, "\nDROP %s IF EXISTS %s;\nDELIMITER ;;\n%s;;\nDELIMITER ;\n", kind, quoteIdent(name), createSQL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// showCreate выполняет SHOW CREATE ... и возвращает значение указанной колонки
+func showCreate(ctx context.Context, conn *sql.Conn, query, column string) (string, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no definition returned")
+	}
+
+	values := make([]sql.NullString, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	for i, name := range columns {
+		if name == column {
+			if !values[i].Valid {
+				return "", fmt.Errorf("definition is not available (insufficient privileges?)")
+			}
+			return values[i].String, nil
+		}
+	}
+	return "", fmt.Errorf("column %q not found", column)
+}
+
+// queryStrings возвращает значения первой колонки результата запроса
+func queryStrings(ctx context.Context, conn *sql.Conn, query string, args ...any) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, rows.Err()
+}
+
+// writeMySQLValue записывает значение колонки в виде SQL-литерала
+func writeMySQLValue(b *strings.Builder, databaseType string, value sql.RawBytes) {
+	switch {
+	case value == nil:
+		b.WriteString("NULL")
+	case mysqlNumericTypes[databaseType]:
+		b.Write(value)
+	case mysqlBinaryTypes[databaseType]:
+		if len(value) == 0 {
+			b.WriteString("''")
+			return
+		}
+		b.WriteString("0x")
+		b.WriteString(hex.EncodeToString(value))
+	default:
+		b.WriteByte('\'')
+		for _, c := range value {
+			switch c {
+			case 0:
+				b.WriteString(`\0`)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\x1a':
+				b.WriteString(`\Z`)
+			case '\'':
+				b.WriteString(`\'`)
+			case '"':
+				b.WriteString(`\"`)
+			case '\\':
+				b.WriteString(`\\`)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('\'')
+	}
+}
+
+// quoteIdent экранирует идентификатор MySQL обратными кавычками
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
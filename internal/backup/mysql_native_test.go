@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const columnsQuery = "SELECT COLUMN_NAME, DATA_TYPE, EXTRA FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+
+// newMySQLMock создает базу sqlmock, сравнивающую запросы целиком
+func newMySQLMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, mock
+}
+
+// expectDumpStart ожидает переключение сессии на UTC, открытие транзакции и запрос версии сервера
+func expectDumpStart(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("SET time_zone='+00:00'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+}
+
+// expectNoRoutines ожидает пустые списки триггеров, процедур и функций
+func expectNoRoutines(mock sqlmock.Sqlmock, dbName string) {
+	mock.ExpectQuery("SELECT TRIGGER_NAME FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = DATABASE()").
+		WillReturnRows(sqlmock.NewRows([]string{"TRIGGER_NAME"}))
+	for _, kind := range []string{"PROCEDURE", "FUNCTION"} {
+		mock.ExpectQuery("SELECT ROUTINE_NAME FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA = ? AND ROUTINE_TYPE = ?").
+			WithArgs(dbName, kind).
+			WillReturnRows(sqlmock.NewRows([]string{"ROUTINE_NAME"}))
+	}
+}
+
+func TestDumpMySQLTableSkipsGeneratedColumns(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	expectDumpStart(mock)
+	mock.ExpectQuery("SHOW FULL TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"Tables_in_shop", "Table_type"}).AddRow("orders", "BASE TABLE"))
+	mock.ExpectQuery("SHOW CREATE TABLE `orders`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("orders", "CREATE TABLE `orders` (...)"))
+	mock.ExpectQuery(columnsQuery).WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "EXTRA"}).
+			AddRow("id", "int", "auto_increment").
+			AddRow("note", "varchar", "").
+			AddRow("payload", "blob", "").
+			AddRow("total", "decimal", "STORED GENERATED").
+			AddRow("created", "timestamp", "DEFAULT_GENERATED"))
+	mock.ExpectQuery("SELECT `id`,`note`,`payload`,`created` FROM `orders`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note", "payload", "created"}).
+			AddRow("1", "it's \"quoted\"\n", []byte{0x00, 0xff}, "2024-01-01 00:00:00").
+			AddRow("2", nil, []byte{}, "2024-01-02 00:00:00"))
+	expectNoRoutines(mock, "shop")
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var out strings.Builder
+	if err := dumpMySQLDatabaseTo(context.Background(), db, "shop", false, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "INSERT INTO `orders` (`id`,`note`,`payload`,`created`) VALUES " +
+		`(1,'it\'s \"quoted\"\n',0x00ff,'2024-01-01 00:00:00'),(2,NULL,'','2024-01-02 00:00:00');`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("dump does not contain %q:\n%s", want, out.String())
+	}
+	if strings.Contains(out.String(), "`total`") {
+		t.Errorf("generated column is dumped:\n%s", out.String())
+	}
+}
+
+func TestDumpMySQLViewsCreatedAfterStandIns(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	expectDumpStart(mock)
+	// a_report ссылается на b_totals, который идет позже по алфавиту
+	mock.ExpectQuery("SHOW FULL TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"Tables_in_shop", "Table_type"}).
+			AddRow("a_report", "VIEW").
+			AddRow("b_totals", "VIEW"))
+	mock.ExpectQuery(columnsQuery).WithArgs("a_report").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "EXTRA"}).AddRow("total", "decimal", ""))
+	mock.ExpectQuery(columnsQuery).WithArgs("b_totals").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "EXTRA"}).
+			AddRow("day", "date", "").
+			AddRow("total", "decimal", ""))
+	expectNoRoutines(mock, "shop")
+	viewColumns := []string{"View", "Create View", "character_set_client", "collation_connection"}
+	mock.ExpectQuery("SHOW CREATE VIEW `a_report`").
+		WillReturnRows(sqlmock.NewRows(viewColumns).AddRow("a_report", "CREATE VIEW `a_report` AS select sum(`total`) AS `total` from `b_totals`", "utf8mb4", "utf8mb4_0900_ai_ci"))
+	mock.ExpectQuery("SHOW CREATE VIEW `b_totals`").
+		WillReturnRows(sqlmock.NewRows(viewColumns).AddRow("b_totals", "CREATE VIEW `b_totals` AS select 1 AS `day`, 2 AS `total`", "utf8mb4", "utf8mb4_0900_ai_ci"))
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var out strings.Builder
+	if err := dumpMySQLDatabaseTo(context.Background(), db, "shop", false, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := out.String()
+	standIn := strings.Index(dump, "CREATE VIEW `b_totals` AS SELECT 1 AS `day`, 1 AS `total`;")
+	report := strings.Index(dump, "CREATE VIEW `a_report` AS select")
+	totals := strings.Index(dump, "CREATE VIEW `b_totals` AS select")
+	if standIn < 0 || report < 0 || totals < 0 {
+		t.Fatalf("missing view definitions:\n%s", dump)
+	}
+	if standIn > report {
+		t.Errorf("a_report is created before the b_totals stand-in:\n%s", dump)
+	}
+}
+
+func TestStreamMySQLDump(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	expectDumpStart(mock)
+	mock.ExpectQuery("SHOW FULL TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"Tables_in_shop", "Table_type"}).AddRow("items", "BASE TABLE"))
+	mock.ExpectQuery("SHOW CREATE TABLE `items`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("items", "CREATE TABLE `items` (`id` int)"))
+	mock.ExpectQuery(columnsQuery).WithArgs("items").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "EXTRA"}).AddRow("id", "int", ""))
+	mock.ExpectQuery("SELECT `id` FROM `items`").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("42"))
+	expectNoRoutines(mock, "shop")
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var uploaded bytes.Buffer
+	var objectName string
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		objectName = name
+		_, err := io.Copy(&uploaded, r)
+		return "project/mysql/" + name, err
+	}
+
+	key, err := streamMySQLDump(context.Background(), db, "shop", false, upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "project/mysql/"+objectName || !strings.HasPrefix(objectName, "shop-") || !strings.HasSuffix(objectName, ".sql.gz") {
+		t.Errorf("unexpected object %q (key %q)", objectName, key)
+	}
+
+	gzr, err := gzip.NewReader(&uploaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump, err := io.ReadAll(gzr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dump), "INSERT INTO `items` (`id`) VALUES (42);") || !strings.Contains(string(dump), "-- Dump completed on") {
+		t.Errorf("unexpected dump:\n%s", dump)
+	}
+}
+
+func TestStreamMySQLDumpQueryError(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	expectDumpStart(mock)
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnError(errors.New("access denied"))
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var uploaded bytes.Buffer
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		_, err := io.Copy(&uploaded, r)
+		return name, err
+	}
+
+	// Ошибка дампера обрывает поток, и загрузка не завершается успешно
+	if _, err := streamMySQLDump(context.Background(), db, "shop", false, upload); err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("expected dump error, got %v", err)
+	}
+}
+
+func TestDumpMySQLRecordsBinlogPosition(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	mock.ExpectExec("SET time_zone='+00:00'").WillReturnResult(sqlmock.NewResult(0, 0))
+	// Позиция читается под глобальной блокировкой, пока открывается снимок
+	mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SHOW MASTER STATUS").
+		WillReturnRows(sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("mysql-bin.000042", 157, "", "", ""))
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT VERSION()").WillReturnRows(sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(sqlmock.NewRows([]string{"Tables_in_shop", "Table_type"}))
+	expectNoRoutines(mock, "shop")
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var out strings.Builder
+	if err := dumpMySQLDatabaseTo(context.Background(), db, "shop", true, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	position, err := readBinlogPosition(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position == nil || *position != (BinlogPosition{File: "mysql-bin.000042", Position: 157}) {
+		t.Errorf("unexpected position %+v in dump:\n%s", position, out.String())
+	}
+}
+
+func TestDumpMySQLTimeZoneError(t *testing.T) {
+	db, mock := newMySQLMock(t)
+	// Без UTC в сессии TIMESTAMP выгрузились бы в часовом поясе сервера, поэтому дамп не начинается
+	mock.ExpectExec("SET time_zone='+00:00'").WillReturnError(errors.New("unknown time zone"))
+
+	var out strings.Builder
+	err := dumpMySQLDatabaseTo(context.Background(), db, "shop", false, &out)
+	if err == nil || !strings.Contains(err.Error(), "failed to set time zone") {
+		t.Fatalf("expected time zone error, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("dump written without UTC session: %q", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
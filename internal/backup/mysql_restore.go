@@ -0,0 +1,305 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// mysqlDumpPattern соответствует имени объекта дампа базы: <db>-<timestamp>.sql.gz
+var mysqlDumpPattern = regexp.MustCompile(`^(.+)-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z)\.sql\.gz$`)
+
+// binlogDateTimeFormat - формат --stop-datetime для mysqlbinlog
+const binlogDateTimeFormat = "2006-01-02 15:04:05"
+
+// MySQLRestoreOptions содержит параметры восстановления MySQL на момент времени
+type MySQLRestoreOptions struct {
+	Database string    // Восстанавливаемая база
+	Until    time.Time // Момент времени, до которого применяются события binlog
+	Target   string    // Сервер для восстановления (по умолчанию source полного бэкапа)
+	DryRun   bool      // Только вывести план восстановления
+}
+
+// RestoreMySQL восстанавливает базу из последнего полного дампа, созданного не позже opts.Until,
+// и применяет поверх него события из архивированных binlog-файлов до opts.Until.
+func RestoreMySQL(ctx context.Context, cfg *config.BackupConfig, bucketName string, binlogItem config.ConfigBackup, opts MySQLRestoreOptions) error {
+	if binlogItem.Type != "mysql-binlog" {
+		return fmt.Errorf("backup %s is not a mysql-binlog backup", binlogItem.Name)
+	}
+	if opts.Database == "" {
+		return fmt.Errorf("database to restore is required")
+	}
+	baseItem, ok := cfg.Backup(binlogItem.BaseBackup)
+	if !ok || baseItem.Type != "mysql" {
+		return fmt.Errorf("backup %s: base-backup must name a mysql backup", binlogItem.Name)
+	}
+
+	target := opts.Target
+	if target == "" {
+		target = baseItem.Source
+	}
+	params, err := parseMySQLConnString(target)
+	if err != nil {
+		return fmt.Errorf("connection string parse error: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "restore-"+binlogItem.Name+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Поиск полного дампа
+	basePrefix := minio.ObjectPrefix(cfg.Project, baseItem.ObjectPath())
+	dumpKey, dumpTime, err := findMySQLDump(ctx, bucketName, basePrefix, opts.Database, opts.Until)
+	if err != nil {
+		return err
+	}
+
+	// События применяются с позиции binlog, записанной в заголовок дампа на момент снимка
+	position, err := readDumpBinlogPosition(ctx, bucketName, dumpKey)
+	if err != nil {
+		return err
+	}
+
+	binlogPrefix := minio.ObjectPrefix(cfg.Project, binlogItem.ObjectPath())
+	index, err := LoadBinlogIndex(ctx, bucketName, binlogPrefix, tmpDir)
+	if err != nil {
+		return err
+	}
+	binlogs, err := selectBinlogs(index.Files, *position, opts.Until)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("restore plan",
+		"database", opts.Database,
+		"dump", dumpKey,
+		"dump_time", dumpTime.Format(time.RFC3339),
+		"binlog_file", position.File,
+		"binlog_position", position.Position,
+		"binlogs", len(binlogs),
+		"until", opts.Until.Format(time.RFC3339),
+	)
+	for _, file := range binlogs {
+		logger.Info("binlog to replay", "file", file.Name, "start_time", file.StartTime.Format(time.RFC3339), "end_position", file.EndPosition)
+	}
+	if len(index.Files) > 0 && opts.Until.After(index.Files[len(index.Files)-1].ArchivedAt) {
+		logger.Warn("requested time is after the last archived binlog; later events are not available")
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	// Загрузка полного дампа
+	dumpPath := filepath.Join(tmpDir, path.Base(dumpKey))
+	if err := minio.DownloadObject(ctx, bucketName, dumpKey, dumpPath, nil); err != nil {
+		return err
+	}
+	createCmd := exec.CommandContext(ctx, "mysql", append(mysqlClientArgs(params), "-e", "CREATE DATABASE IF NOT EXISTS "+quoteIdent(opts.Database))...)
+	if err := runTool(ctx, createCmd); err != nil {
+		return err
+	}
+	if err := loadMySQLDump(ctx, params, opts.Database, dumpPath); err != nil {
+		return fmt.Errorf("failed to load dump: %w", err)
+	}
+	logger.Info("full dump restored", "dump", dumpKey)
+
+	if len(binlogs) == 0 {
+		return nil
+	}
+
+	// Применение binlog-файлов
+	binlogPaths := make([]string, 0, len(binlogs))
+	for _, file := range binlogs {
+		archivePath := filepath.Join(tmpDir, file.Object)
+		if err := minio.DownloadObject(ctx, bucketName, path.Join(binlogPrefix, file.Object), archivePath, nil); err != nil {
+			return err
+		}
+		rawPath := filepath.Join(tmpDir, file.Name)
+		if err := gunzipFile(archivePath, rawPath); err != nil {
+			return fmt.Errorf("binlog %s: %w", file.Name, err)
+		}
+		binlogPaths = append(binlogPaths, rawPath)
+	}
+
+	replayPath := filepath.Join(tmpDir, "replay.sql")
+	args := []string{
+		"--database=" + opts.Database,
+		// --start-position относится к первому файлу, с которого начинается список
+		"--start-position=" + strconv.FormatInt(position.Position, 10),
+		"--stop-datetime=" + opts.Until.UTC().Format(binlogDateTimeFormat),
+		"--result-file=" + replayPath,
+	}
+	binlogCmd := exec.CommandContext(ctx, "mysqlbinlog", append(args, binlogPaths...)...)
+	// Время в --stop-datetime интерпретируется в часовом поясе клиента
+	binlogCmd.Env = append(os.Environ(), "TZ=UTC")
+	if err := runTool(ctx, binlogCmd); err != nil {
+		return err
+	}
+
+	replay, err := os.Open(replayPath)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %w", err)
+	}
+	defer replay.Close()
+
+	replayCmd := exec.CommandContext(ctx, "mysql", append(mysqlClientArgs(params), opts.Database)...)
+	replayCmd.Stdin = replay
+	if err := runTool(ctx, replayCmd); err != nil {
+		return fmt.Errorf("failed to replay binlogs: %w", err)
+	}
+
+	logger.Info("point-in-time restore completed", "database", opts.Database, "until", opts.Until.Format(time.RFC3339))
+	return nil
+}
+
+// findMySQLDump возвращает ключ и время последнего дампа базы, завершенного не позже until.
+// Используется время загрузки объекта: метка в имени записана в локальном времени сервера
+// и взята до начала выгрузки, а снимок данных не может быть позже окончания загрузки.
+func findMySQLDump(ctx context.Context, bucketName, prefix, dbName string, until time.Time) (string, time.Time, error) {
+	objects, err := minio.ListObjects(ctx, bucketName, prefix)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var key string
+	var dumpTime time.Time
+	for _, object := range objects {
+		match := mysqlDumpPattern.FindStringSubmatch(path.Base(object.Key))
+		if match == nil || match[1] != dbName {
+			continue
+		}
+		uploaded := object.LastModified.UTC()
+		if uploaded.After(until) {
+			continue
+		}
+		if uploaded.After(dumpTime) {
+			key, dumpTime = object.Key, uploaded
+		}
+	}
+
+	if key == "" {
+		return "", time.Time{}, fmt.Errorf("no dump of database %s found before %s", dbName, until.Format(time.RFC3339))
+	}
+	return key, dumpTime, nil
+}
+
+// readDumpBinlogPosition читает позицию binlog из заголовка сжатого дампа в бакете
+func readDumpBinlogPosition(ctx context.Context, bucketName, key string) (*BinlogPosition, error) {
+	object, err := minio.OpenObject(ctx, bucketName, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	gzr, err := gzip.NewReader(object)
+	if err != nil {
+		return nil, fmt.Errorf("dump %s: %w", path.Base(key), err)
+	}
+	defer gzr.Close()
+
+	position, err := readBinlogPosition(gzr)
+	if err != nil {
+		return nil, fmt.Errorf("dump %s: %w", path.Base(key), err)
+	}
+	if position == nil {
+		return nil, fmt.Errorf("dump %s has no binlog position; take a new full dump to use it for point-in-time recovery", path.Base(key))
+	}
+	return position, nil
+}
+
+// selectBinlogs возвращает архивированные binlog-файлы, начиная с файла позиции дампа,
+// до первого файла, созданного после until
+func selectBinlogs(files []BinlogFile, position BinlogPosition, until time.Time) ([]BinlogFile, error) {
+	start := -1
+	for i, file := range files {
+		if file.Name == position.File {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		// Файл еще открыт сервером: после дампа не было ротаций, применять нечего
+		if len(files) == 0 || position.File > files[len(files)-1].Name {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("binlog %s with the dump position is not archived", position.File)
+	}
+
+	selected := []BinlogFile{files[start]}
+	for _, file := range files[start+1:] {
+		if file.StartTime.After(until) {
+			break
+		}
+		selected = append(selected, file)
+	}
+	return selected, nil
+}
+
+// loadMySQLDump загружает сжатый SQL-дамп в базу с помощью клиента mysql
+func loadMySQLDump(ctx context.Context, params *MySQLParams, dbName, dumpPath string) error {
+	file, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	cmd := exec.CommandContext(ctx, "mysql", append(mysqlClientArgs(params), dbName)...)
+	cmd.Stdin = gzr
+	return runTool(ctx, cmd)
+}
+
+// mysqlClientArgs возвращает аргументы подключения для клиента mysql
+func mysqlClientArgs(params *MySQLParams) []string {
+	return []string{
+		"-h", params.Host,
+		"-P", params.Port,
+		"-u", params.User,
+		"--password=" + params.Password,
+	}
+}
+
+// gunzipFile распаковывает gzip-файл source в target
+func gunzipFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gzr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, gzr); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadBinlogPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+		want *BinlogPosition
+	}{
+		{
+			name: "mysqldump --master-data=2",
+			dump: "-- MySQL dump 10.13\n--\n-- Position to start replication or point-in-time recovery from\n--\n\n" +
+				"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=1234;\n\nCREATE TABLE t (id int);\n",
+			want: &BinlogPosition{File: "mysql-bin.000003", Position: 1234},
+		},
+		{
+			name: "mysqldump --source-data=2",
+			dump: "-- MySQL dump 10.13\n\n-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000010', SOURCE_LOG_POS=157;\n",
+			want: &BinlogPosition{File: "binlog.000010", Position: 157},
+		},
+		{
+			name: "no position",
+			dump: "-- MySQL dump 10.13\nCREATE TABLE t (id int);\nINSERT INTO t VALUES (1);\n",
+		},
+		{
+			name: "position in data is ignored",
+			dump: strings.Repeat("INSERT INTO t VALUES (1);\n", binlogPositionScanLines) +
+				"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000001', MASTER_LOG_POS=4;\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBinlogPosition(strings.NewReader(tt.dump))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("readBinlogPosition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectBinlogs(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := []BinlogFile{
+		{Name: "mysql-bin.000001", StartTime: base},
+		{Name: "mysql-bin.000002", StartTime: base.Add(time.Hour)},
+		{Name: "mysql-bin.000003", StartTime: base.Add(2 * time.Hour)},
+	}
+	names := func(files []BinlogFile) string {
+		var list []string
+		for _, file := range files {
+			list = append(list, file.Name)
+		}
+		return strings.Join(list, ",")
+	}
+
+	tests := []struct {
+		name     string
+		position BinlogPosition
+		until    time.Time
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "from dump file to until",
+			position: BinlogPosition{File: "mysql-bin.000002", Position: 500},
+			until:    base.Add(90 * time.Minute),
+			want:     "mysql-bin.000002",
+		},
+		{
+			name:     "all following files",
+			position: BinlogPosition{File: "mysql-bin.000001", Position: 4},
+			until:    base.Add(3 * time.Hour),
+			want:     "mysql-bin.000001,mysql-bin.000002,mysql-bin.000003",
+		},
+		{
+			name:     "dump file not rotated yet",
+			position: BinlogPosition{File: "mysql-bin.000004", Position: 4},
+			until:    base.Add(3 * time.Hour),
+		},
+		{
+			name:     "dump file missing from archive",
+			position: BinlogPosition{File: "mysql-bin.000000", Position: 4},
+			until:    base.Add(3 * time.Hour),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectBinlogs(files, tt.position, tt.until)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectBinlogs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if names(got) != tt.want {
+				t.Errorf("selectBinlogs() = %s, want %s", names(got), tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package backup
 
 import (
-	"bytes"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -46,30 +48,26 @@ func parseConnString(connString string) (*ConnectionParams, error) {
 	}, nil
 }
 
-// BackupPostgres выполняет резервное копирование с использованием pg_basebackup
-func BackupPostgres(connString, outputDir string) (string, error) {
-	params, err := parseConnString(connString)
+// BackupPostgres выполняет резервное копирование с использованием pg_basebackup.
+// pg_basebackup пишет в директорию tar-файлы основного табличного пространства, дополнительных
+// табличных пространств, WAL (при wal-method: stream) и манифест; директория упаковывается в один архив.
+func BackupPostgres(ctx context.Context, backupItem config.ConfigBackup, outputDir string) (string, error) {
+	params, err := parseConnString(backupItem.Source)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse connection string: %w", err)
 	}
 
-	// Создаем имя файла с временной меткой
+	// Создаем имя архива с временной меткой
 	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
-	baseName := fmt.Sprintf("%s-%s.tar.gz", params.DBName, timestamp)
-	dumpPath := filepath.Join(outputDir, baseName)
+	name := params.DBName
+	if name == "" {
+		name = backupItem.Name
+	}
+	baseName := fmt.Sprintf("%s-%s", name, timestamp)
+	dataDir := filepath.Join(outputDir, baseName)
 
 	// Формируем команду pg_basebackup
-	cmd := exec.Command(
-		"pg_basebackup",
-		"-h", params.Host,
-		"-p", params.Port,
-		"-U", params.User,
-		"-D", "-",    // Вывод в stdout
-		"-Ft",        // Формат tar
-		"-z",         // Сжатие
-		"-P",         // Прогресс-бар
-		"--label", fmt.Sprintf("%s_%s", params.DBName, timestamp),
-	)
+	cmd := exec.CommandContext(ctx, "pg_basebackup", postgresArgs(params, backupItem.Postgres, dataDir, baseName)...)
 
 	// Настраиваем переменные окружения
 	cmd.Env = append(os.Environ(),
@@ -77,22 +75,50 @@ func BackupPostgres(connString, outputDir string) (string, error) {
 		"PGDATABASE="+params.DBName,
 	)
 
-	// Перенаправляем stdout в файл
-	outputFile, err := os.Create(dumpPath)
+	// Выполняем команду; stderr попадает в лог
+	if err := runTool(ctx, cmd); err != nil {
+		return "", err
+	}
+
+	// Упаковываем директорию; tar-файлы внутри не сжимаются, чтобы не сжимать данные дважды
+	archivePath, err := TarFolder(ctx, dataDir, dataDir+".tar.gz", nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %w", err)
+		return "", fmt.Errorf("failed to archive backup directory: %w", err)
+	}
+	if err := os.RemoveAll(dataDir); err != nil {
+		logging.FromContext(ctx).Warn("failed to remove temp directory", "path", dataDir, "error", err)
 	}
-	defer outputFile.Close()
-	cmd.Stdout = outputFile
 
-	// Захватываем stderr для вывода ошибок
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	return archivePath, nil
+}
 
-	// Выполняем команду
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("pg_basebackup failed: %v, stderr: %s", err, stderr.String())
+// postgresArgs формирует аргументы pg_basebackup
+func postgresArgs(params *ConnectionParams, opts config.PostgresOptions, dataDir, label string) []string {
+	walMethod := opts.WALMethod
+	if walMethod == "" {
+		walMethod = "stream"
 	}
 
-	return dumpPath, nil
-}
\ No newline at end of file
+	args := []string{
+		"-h", params.Host,
+		"-p", params.Port,
+		"-U", params.User,
+		"-D", dataDir,
+		"-Ft", // Формат tar: отдельный файл на каждое табличное пространство
+		"--wal-method=" + walMethod,
+		"--label", label,
+	}
+	if opts.Slot != "" {
+		args = append(args, "--slot="+opts.Slot)
+	}
+	if opts.FastCheckpoint {
+		args = append(args, "--checkpoint=fast")
+	}
+	if opts.MaxRate > 0 {
+		args = append(args, fmt.Sprintf("--max-rate=%dk", opts.MaxRate/1024))
+	}
+	if opts.ManifestChecksums != "" {
+		args = append(args, "--manifest-checksums="+strings.ToUpper(opts.ManifestChecksums))
+	}
+	return args
+}
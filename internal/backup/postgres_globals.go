@@ -0,0 +1,116 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BackupPostgresGlobals выгружает роли и табличные пространства кластера с помощью pg_dumpall --globals-only.
+// При dump-databases или заданном списке databases каждая база дополнительно выгружается
+// отдельным файлом pg_dump в формате custom, чтобы кластер можно было восстановить целиком.
+func BackupPostgresGlobals(ctx context.Context, backupItem config.ConfigBackup, outputDir string) ([]string, error) {
+	params, err := parseConnString(backupItem.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	env := append(os.Environ(), "PGPASSWORD="+params.Password)
+
+	// Глобальные объекты кластера
+	globalsPath := filepath.Join(outputDir, fmt.Sprintf("globals-%s.sql", timestamp))
+	args := append(postgresConnArgs(params), "--globals-only", "--file", globalsPath)
+	if params.DBName != "" {
+		args = append(args, "--database", params.DBName)
+	}
+	cmd := exec.CommandContext(ctx, "pg_dumpall", args...)
+	cmd.Env = env
+	if err := runTool(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	globalsArchive, err := GzFile(globalsPath)
+	if err != nil {
+		return nil, fmt.Errorf("compression failed: %w", err)
+	}
+	if err := os.Remove(globalsPath); err != nil {
+		logging.FromContext(ctx).Warn("failed to remove temp file", "path", globalsPath, "error", err)
+	}
+	files := []string{globalsArchive}
+
+	if !backupItem.DumpDatabases && len(backupItem.Databases) == 0 {
+		return files, nil
+	}
+
+	databases, err := postgresDatabases(ctx, params, backupItem)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbName := range databases {
+		dumpPath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.dump", dbName, timestamp))
+		args := append(postgresConnArgs(params), "--format=custom", "--file", dumpPath, "--dbname", dbName)
+
+		cmd := exec.CommandContext(ctx, "pg_dump", args...)
+		cmd.Env = env
+		if err := runTool(logging.WithLogger(ctx, logging.FromContext(ctx).With("database", dbName)), cmd); err != nil {
+			return nil, fmt.Errorf("database %s: %w", dbName, err)
+		}
+		files = append(files, dumpPath)
+	}
+
+	return files, nil
+}
+
+// postgresDatabases определяет список баз для выгрузки: databases из конфигурации
+// или все базы сервера, к которым разрешено подключение, кроме шаблонов
+func postgresDatabases(ctx context.Context, params *ConnectionParams, backupItem config.ConfigBackup) ([]string, error) {
+	databases := slices.Clone(backupItem.Databases)
+	if len(databases) == 0 {
+		args := append(postgresConnArgs(params),
+			"--no-align", "--tuples-only", "--no-psqlrc",
+			"--command", "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname",
+		)
+		if params.DBName != "" {
+			args = append(args, "--dbname", params.DBName)
+		} else {
+			args = append(args, "--dbname", "postgres")
+		}
+
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, "psql", args...)
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+params.Password)
+		cmd.Stdout = &stdout
+		if err := runTool(ctx, cmd); err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				databases = append(databases, line)
+			}
+		}
+	}
+
+	return slices.DeleteFunc(databases, func(dbName string) bool {
+		return matchesAny(dbName, backupItem.ExcludeDatabases)
+	}), nil
+}
+
+// postgresConnArgs возвращает общие аргументы подключения для утилит PostgreSQL
+func postgresConnArgs(params *ConnectionParams) []string {
+	return []string{
+		"--host", params.Host,
+		"--port", params.Port,
+		"--username", params.User,
+		"--no-password",
+	}
+}
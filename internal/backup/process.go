@@ -2,86 +2,326 @@ package backup
 
 import (
 	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
 	"backup-to-minio/internal/minio"
+	"backup-to-minio/internal/redis"
+	"backup-to-minio/internal/throttle"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// ProcessBackup обрабатывает резервное копирование для каждого элемента из конфигурации
-func ProcessBackup(cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string) error {
-	// Генерация временной метки для имен файлов
-	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+// ProcessBackup обрабатывает резервное копирование для каждого элемента из конфигурации.
+// При отмене ctx или истечении timeout задания дочерние процессы завершаются, а временные файлы удаляются.
+// Общие ограничения скорости global действуют вместе с ограничениями бэкапа limits, которые
+// создаются один раз на задание и разделяются между его параллельными запусками.
+// Возвращает общий размер объектов запуска (0 для elasticsearch, s3 и mysql-binlog).
+func ProcessBackup(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string, global, limits throttle.Limits) (int64, error) {
+	if backupItem.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, backupItem.Timeout)
+		defer cancel()
+	}
+
+	// Создаем отдельную временную директорию для запуска, чтобы параллельные запуски не пересекались
+	baseTmpDir := filepath.Join(os.TempDir(), "backups", cfg.Project)
+	if err := os.MkdirAll(baseTmpDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(baseTmpDir, backupItem.Name+"-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			logging.FromContext(ctx).Warn("failed to remove temp directory", "path", tmpDir, "error", err)
+		}
+	}()
+
+	info := hookInfo{
+		Project: cfg.Project,
+		Name:    backupItem.Name,
+		Type:    backupItem.Type,
+	}
 
-	// Создаем временную директорию для бэкапов
-	tmpDir := filepath.Join(os.TempDir(), "backups", cfg.Project)
-	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+	// Pre-хуки: ошибка обязательного хука отменяет резервное копирование
+	err = runHooks(ctx, "pre", backupItem.Hooks.Pre, info)
+	if err == nil {
+		info.Archive, info.Object, info.Size, err = runBackup(ctx, cfg, backupItem, bucketName, tmpDir, global, limits)
+	}
+
+	info.Status = hookStatusSuccess
+	if err != nil {
+		info.Status = hookStatusFailure
+		info.Error = err.Error()
+	}
+
+	// Post-хуки выполняются всегда, даже если контекст задания уже отменен
+	hookCtx := context.WithoutCancel(ctx)
+	if hookErr := runHooks(hookCtx, "post", backupItem.Hooks.Post, info); hookErr != nil && err == nil {
+		err = hookErr
+	}
+	if err == nil {
+		if hookErr := runHooks(hookCtx, "on_success", backupItem.Hooks.OnSuccess, info); hookErr != nil {
+			err = hookErr
+		}
+	} else if hookErr := runHooks(hookCtx, "on_failure", backupItem.Hooks.OnFailure, info); hookErr != nil {
+		logging.FromContext(ctx).Warn("on_failure hook failed", "error", hookErr)
+	}
+
+	if err != nil {
+		return 0, err
 	}
+	logging.FromContext(ctx).Info("backup processed successfully", "size", info.Size)
+
+	return info.Size, nil
+}
+
+// runBackup создает резервную копию во временной директории и загружает ее в MinIO.
+// Возвращает пути к архивам, полные ключи объектов в бакете (через пробел, если их несколько)
+// и их общий размер.
+func runBackup(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName, tmpDir string, global, limits throttle.Limits) (string, string, int64, error) {
+	// Генерация временной метки для имен файлов
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
 
 	var filePath string
+	var filePaths []string
 	var err error
 
+	// Типы, которые передают данные потоком, загружают их сами через upload
+	var streamedKeys []string
+	// Сведения о запуске для манифеста
+	details := make(map[string]string)
+	// Логгер берется из контекста запуска, чтобы stage не дублировался контекстом этапа dump
+	upload := func(streamCtx context.Context, name string, r io.Reader) (string, error) {
+		objectName := path.Join(filepath.ToSlash(backupItem.ObjectPath()), name)
+		uploadCtx := logging.WithLogger(streamCtx, logging.FromContext(logging.WithStage(ctx, "upload")))
+		err := minio.UploadToMinio(uploadCtx, minio.UploadParams{
+			Project:    cfg.Project,
+			BucketName: bucketName,
+			ObjectPath: objectName,
+			Reader:     r,
+			Throttle:   []*throttle.Limiter{global.Upload, limits.Upload},
+		})
+		return path.Join(cfg.Project, objectName), err
+	}
+
 	// Обработка разных типов бэкапов
+	dumpCtx := logging.WithStage(ctx, "dump")
 	switch backupItem.Type {
 	case "folder":
 		tarName := fmt.Sprintf("%s-%s.tar.gz", backupItem.Name, timestamp)
 		tmpFilePath := filepath.Join(tmpDir, tarName)
-		filePath, err = TarFolder(backupItem.Source, tmpFilePath)
-	
+		filePath, err = TarFolder(dumpCtx, backupItem.Source, tmpFilePath, backupItem.Exclude, global.Read, limits.Read)
+
+	case "s3":
+		// Объекты копируются напрямую в бакет, загружать нечего
+		var key string
+		key, err = BackupS3(dumpCtx, cfg, backupItem, bucketName, global.Upload, limits.Upload)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+		}
+
+	case "sftp", "ssh-folder":
+		var key string
+		key, err = BackupSFTP(dumpCtx, backupItem, upload, global.Read, limits.Read)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+		}
+
 	case "mongodb":
-		filePath, err = BackupMongoDB(backupItem.Source, tmpDir)
+		var key string
+		key, err = BackupMongoDB(dumpCtx, backupItem, tmpDir, upload)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+			logging.FromContext(dumpCtx).Info("MongoDB backup created", "object", key)
+		}
+
+	case "redis":
+		var key string
+		key, err = BackupRedis(dumpCtx, backupItem, upload)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+			logging.FromContext(dumpCtx).Info("Redis backup created", "object", key)
+		}
+
+	case "etcd":
+		var key string
+		key, details["sha256"], err = BackupEtcd(dumpCtx, backupItem, upload)
 		if err == nil {
-			log.Printf("MongoDB backup created: %s", filePath)
+			streamedKeys = append(streamedKeys, key)
+			logging.FromContext(dumpCtx).Info("etcd backup created", "object", key)
+		}
+
+	case "elasticsearch":
+		// Снимок пишет сам кластер, загружать нечего
+		var key string
+		key, err = BackupElasticsearch(dumpCtx, cfg, backupItem, bucketName)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+		}
+
+	case "clickhouse":
+		var keys []string
+		var size int64
+		keys, size, err = BackupClickHouse(dumpCtx, cfg, backupItem, bucketName, upload)
+		if err == nil {
+			streamedKeys = append(streamedKeys, keys...)
+			details["uncompressed_size"] = strconv.FormatInt(size, 10)
+			logging.FromContext(dumpCtx).Info("ClickHouse backup created", "objects", len(keys), "uncompressed_size", size)
+		}
+
+	case "command":
+		if backupItem.Command.OutputDir {
+			filePath, err = BackupCommandDir(dumpCtx, backupItem, tmpDir, global.Read, limits.Read)
+			break
+		}
+		var key string
+		key, err = BackupCommand(dumpCtx, backupItem, upload)
+		if err == nil {
+			streamedKeys = append(streamedKeys, key)
+			logging.FromContext(dumpCtx).Info("command backup created", "object", key)
+		}
+
+	case "sqlite":
+		filePath, err = BackupSQLite(dumpCtx, backupItem.Name, backupItem.Source, tmpDir)
+		if err == nil {
+			logging.FromContext(dumpCtx).Info("SQLite backup created", "path", filePath)
 		}
 
 	case "postgres":
-		filePath, err = BackupPostgres(backupItem.Source, tmpDir)
+		filePath, err = BackupPostgres(dumpCtx, backupItem, tmpDir)
+		if err == nil {
+			logging.FromContext(dumpCtx).Info("Postgres backup created", "path", filePath)
+		}
+
+	case "postgres-globals":
+		filePaths, err = BackupPostgresGlobals(dumpCtx, backupItem, tmpDir)
 		if err == nil {
-			log.Printf("Postgres backup created: %s", filePath)
+			logging.FromContext(dumpCtx).Info("Postgres globals backup created", "files", len(filePaths))
 		}
 
 	case "mysql":
-		filePath, err = BackupMySQL(backupItem.Source, tmpDir)
+		var keys []string
+		filePaths, keys, err = BackupMySQL(dumpCtx, cfg, backupItem, tmpDir, upload)
 		if err == nil {
-			log.Printf("MySQL backup created: %s", filePath)
+			streamedKeys = append(streamedKeys, keys...)
+			logging.FromContext(dumpCtx).Info("MySQL backup created", "databases", len(filePaths)+len(keys))
 		}
 
+	case "mysql-binlog":
+		filePaths, err = BackupMySQLBinlog(dumpCtx, cfg, backupItem, bucketName, tmpDir)
+
 	default:
-		return fmt.Errorf("unsupported backup type: %s", backupItem.Type)
+		return "", "", 0, fmt.Errorf("unsupported backup type: %s", backupItem.Type)
 	}
 
 	if err != nil {
-		return fmt.Errorf("backup failed for %s: %w", backupItem.Name, err)
+		return "", "", 0, fmt.Errorf("backup failed for %s: %w", backupItem.Name, err)
 	}
-
-	// Формирование пути в бакете
-	objectPath := backupItem.PathSave
-	if objectPath == "" {
-		objectPath = backupItem.Name
+	if filePath != "" {
+		filePaths = append(filePaths, filePath)
 	}
-	objectName := filepath.Join(objectPath, filepath.Base(filePath))
 
-	// Параметры для загрузки в MinIO
-	uploadParams := minio.UploadParams{
-		Project:    cfg.Project,
-		BucketName: bucketName,
-		ObjectPath: objectName,
-		FilePath:   filePath,
+	// Загрузка в MinIO; временные файлы удаляются вместе с временной директорией запуска
+	uploadCtx := logging.WithStage(ctx, "upload")
+	objectKeys := append(make([]string, 0, len(filePaths)+len(streamedKeys)), streamedKeys...)
+	for _, filePath := range filePaths {
+		// Формирование пути в бакете
+		objectName := filepath.Join(backupItem.ObjectPath(), filepath.Base(filePath))
+
+		// Параметры для загрузки в MinIO
+		uploadParams := minio.UploadParams{
+			Project:    cfg.Project,
+			BucketName: bucketName,
+			ObjectPath: objectName,
+			FilePath:   filePath,
+			Throttle:   []*throttle.Limiter{global.Upload, limits.Upload},
+		}
+
+		objectKeys = append(objectKeys, path.Join(cfg.Project, filepath.ToSlash(objectName)))
+		if err := minio.UploadToMinio(uploadCtx, uploadParams); err != nil {
+			return strings.Join(filePaths, " "), strings.Join(objectKeys, " "), 0, fmt.Errorf("minio upload failed: %w", err)
+		}
 	}
 
-	// Загрузка в MinIO
-	if err := minio.UploadToMinio(uploadParams); err != nil {
-		return fmt.Errorf("minio upload failed: %w", err)
+	// Размер запуска; объекты s3 и подобных типов не принадлежат одному запуску
+	var size int64
+	if backupItem.RunObjects() {
+		if size, err = runSize(uploadCtx, bucketName, objectKeys); err != nil {
+			return strings.Join(filePaths, " "), strings.Join(objectKeys, " "), 0, fmt.Errorf("failed to get backup size: %w", err)
+		}
 	}
 
-	// Очистка временных файлов
-	if err := os.Remove(filePath); err != nil {
-		log.Printf("Warning: failed to remove temp file %s: %v", filePath, err)
+	// Манифесты объектов и удаление старых запусков по retention
+	if backupItem.HasManifests() {
+		createdAt := time.Now().UTC().Truncate(time.Second)
+		if err := writeManifests(uploadCtx, cfg, backupItem, bucketName, objectKeys, details, createdAt); err != nil {
+			return strings.Join(filePaths, " "), strings.Join(objectKeys, " "), size, err
+		}
+		retentionCtx := logging.WithStage(ctx, "retention")
+		if err := PruneRuns(retentionCtx, cfg, backupItem, bucketName, createdAt); err != nil {
+			return strings.Join(filePaths, " "), strings.Join(objectKeys, " "), size, fmt.Errorf("retention failed: %w", err)
+		}
+		// WAL старше самого старого оставшегося базового бэкапа больше не нужен. Файл истории
+		// нового бэкапа может еще не дойти до архива, поэтому ошибка не проваливает запуск
+		if backupItem.Type == "postgres" {
+			if err := PruneWAL(retentionCtx, cfg, backupItem, bucketName, false); err != nil {
+				logging.FromContext(retentionCtx).Warn("WAL prune skipped", "error", err)
+			}
+		}
 	}
-	log.Printf("Successfully processed backup: %s", backupItem.Name)
 
-	return nil
+	return strings.Join(filePaths, " "), strings.Join(objectKeys, " "), size, nil
+}
+
+// SourceHost возвращает адрес сервера источника (host:port) для ограничения параллельности.
+// Для локальных источников возвращается пустая строка.
+func SourceHost(backupItem config.ConfigBackup) string {
+	switch backupItem.Type {
+	case "mongodb":
+		if params, err := parseMongoConnString(backupItem.Source); err == nil {
+			return strings.Join(params.Hosts, ",")
+		}
+	case "postgres", "postgres-globals":
+		if params, err := parseConnString(backupItem.Source); err == nil && params.Host != "" {
+			return params.Host + ":" + params.Port
+		}
+	case "etcd":
+		endpoint, _, _ := strings.Cut(backupItem.Source, ",")
+		endpoint = strings.TrimSpace(endpoint)
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			return u.Host
+		}
+		return endpoint
+	case "sftp", "ssh-folder":
+		if target, err := parseSFTPSource(backupItem.Source); err == nil {
+			return target.Addr
+		}
+	case "s3":
+		if source, err := parseS3Source(backupItem); err == nil && source.Endpoint != nil {
+			u, _ := url.Parse(source.Endpoint.URL)
+			return u.Host
+		}
+	case "elasticsearch", "clickhouse":
+		if u, err := url.Parse(backupItem.Source); err == nil {
+			return u.Host
+		}
+	case "redis":
+		if opts, err := redis.ParseURL(backupItem.Source, ""); err == nil {
+			return opts.Addr
+		}
+	case "mysql", "mysql-binlog":
+		if params, err := parseMySQLConnString(backupItem.Source); err == nil && params.Host != "" {
+			return params.Host + ":" + params.Port
+		}
+	}
+	return ""
 }
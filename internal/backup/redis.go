@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/redis"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// redisPollInterval - интервал опроса состояния BGSAVE
+const redisPollInterval = time.Second
+
+// BackupRedis создает снимок Redis и загружает RDB в бакет потоком, сжатым gzip.
+// При заданном rdb-path выполняется BGSAVE с ожиданием завершения и копируется локальный файл,
+// иначе снимок запрашивается по протоколу репликации (SYNC), как redis-cli --rdb.
+func BackupRedis(ctx context.Context, backupItem config.ConfigBackup, upload streamUploader) (string, error) {
+	opts, err := redis.ParseURL(backupItem.Source, backupItem.Redis.TLSCAFile)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := redis.Dial(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	archiveName := fmt.Sprintf("%s-%s.rdb.gz", backupItem.Name, timestamp)
+	logger := logging.FromContext(ctx)
+
+	if rdbPath := backupItem.Redis.RDBPath; rdbPath != "" {
+		if err := conn.BGSave(ctx, redisPollInterval); err != nil {
+			return "", err
+		}
+		logger.Info("BGSAVE completed")
+
+		return streamGzip(ctx, archiveName, upload, func(w io.Writer) error {
+			file, err := os.Open(rdbPath)
+			if err != nil {
+				return fmt.Errorf("failed to open RDB file: %w", err)
+			}
+			defer file.Close()
+
+			_, err = io.Copy(w, &contextReader{ctx: ctx, r: file})
+			return err
+		})
+	}
+
+	return streamGzip(ctx, archiveName, upload, func(w io.Writer) error {
+		n, err := conn.SyncRDB(w)
+		if err != nil {
+			return fmt.Errorf("RDB sync failed: %w", err)
+		}
+		logger.Info("RDB received", "size", n)
+		return nil
+	})
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"backup-to-minio/internal/throttle"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// S3Source содержит бакет и префикс источника зеркалирования
+type S3Source struct {
+	Endpoint *minio.S3Endpoint // Сервер источника (nil - MinIO из окружения)
+	Bucket   string
+	Prefix   string
+}
+
+// parseS3Source разбирает source вида s3://bucket/prefix или https://host/bucket/prefix.
+// Адрес, совпадающий с MINIO_ENDPOINT, без отдельных ключей считается тем же сервером.
+func parseS3Source(backupItem config.ConfigBackup) (*S3Source, error) {
+	u, err := url.Parse(backupItem.Source)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 source: expected s3://bucket/prefix or https://host/bucket/prefix")
+	}
+
+	var source S3Source
+	switch u.Scheme {
+	case "s3":
+		source.Bucket = u.Host
+		source.Prefix = strings.TrimPrefix(u.Path, "/")
+	case "http", "https":
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("bucket is required in S3 source")
+		}
+		source.Bucket, source.Prefix = bucket, prefix
+
+		opts := backupItem.S3
+		local, _ := url.Parse(minio.EndpointURL())
+		if opts.AccessKey != "" || local == nil || local.Host != u.Host {
+			source.Endpoint = &minio.S3Endpoint{
+				URL:       u.Scheme + "://" + u.Host,
+				AccessKey: opts.AccessKey,
+				SecretKey: opts.SecretKey,
+				Region:    opts.Region,
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported S3 source scheme: %s", u.Scheme)
+	}
+
+	// Префикс зеркалируется как каталог
+	if source.Prefix != "" && !strings.HasSuffix(source.Prefix, "/") {
+		source.Prefix += "/"
+	}
+	return &source, nil
+}
+
+// BackupS3 зеркалирует бакет или префикс источника в путь бэкапа: копирует новые и измененные
+// объекты и хранит копии удаленных из источника объектов в течение keep-deleted.
+// Возвращает префикс копии в бакете.
+func BackupS3(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string, limiters ...*throttle.Limiter) (string, error) {
+	source, err := parseS3Source(backupItem)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := minio.ObjectPrefix(cfg.Project, backupItem.ObjectPath())
+	// Зеркало внутри источника (или наоборот) копировало бы само себя
+	if source.Endpoint == nil && source.Bucket == bucketName &&
+		(strings.HasPrefix(prefix, source.Prefix) || strings.HasPrefix(source.Prefix, prefix)) {
+		return "", fmt.Errorf("source %s/%s overlaps the backup path %s", source.Bucket, source.Prefix, prefix)
+	}
+
+	stats, err := minio.Mirror(ctx, minio.MirrorParams{
+		Source:       source.Endpoint,
+		SourceBucket: source.Bucket,
+		SourcePrefix: source.Prefix,
+		BucketName:   bucketName,
+		Prefix:       prefix,
+		KeepDeleted:  backupItem.S3.KeepDeletedFor(),
+		Throttle:     limiters,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logging.FromContext(ctx).Info("bucket mirrored",
+		"source", source.Bucket+"/"+source.Prefix,
+		"server_side", source.Endpoint == nil,
+		"copied", stats.Copied,
+		"skipped", stats.Skipped,
+		"size", stats.Bytes,
+		"marked_deleted", stats.Marked,
+		"removed", stats.Removed,
+	)
+	return prefix, nil
+}
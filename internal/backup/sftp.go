@@ -0,0 +1,267 @@
+package backup
+
+import (
+	"archive/tar"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/throttle"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDialTimeout - время на подключение и SSH-рукопожатие
+const sftpDialTimeout = 30 * time.Second
+
+// SFTPTarget содержит параметры подключения из source вида sftp://user@host:22/path
+type SFTPTarget struct {
+	User string
+	Addr string // host:port
+	Path string // Архивируемая директория на сервере
+}
+
+// parseSFTPSource разбирает адрес удаленной директории
+func parseSFTPSource(source string) (*SFTPTarget, error) {
+	u, err := url.Parse(source)
+	if err != nil || (u.Scheme != "sftp" && u.Scheme != "ssh") || u.Host == "" {
+		return nil, fmt.Errorf("invalid SFTP source: expected sftp://user@host:port/path")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("user is required in SFTP source")
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, fmt.Errorf("passwords are not supported in SFTP source, use key-file or ssh-agent")
+	}
+	if u.Path == "" {
+		return nil, fmt.Errorf("remote directory is required in SFTP source")
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	return &SFTPTarget{
+		User: u.User.Username(),
+		Addr: net.JoinHostPort(u.Hostname(), port),
+		Path: path.Clean(u.Path),
+	}, nil
+}
+
+// BackupSFTP архивирует директорию удаленного сервера по SFTP и загружает архив
+// <имя>-<timestamp>.tar.gz в бакет потоком. Файлы и папки, попадающие под exclude, пропускаются.
+// Возвращает полный ключ объекта.
+func BackupSFTP(ctx context.Context, backupItem config.ConfigBackup, upload streamUploader, limiters ...*throttle.Limiter) (string, error) {
+	target, err := parseSFTPSource(backupItem.Source)
+	if err != nil {
+		return "", err
+	}
+
+	sshClient, err := dialSSH(ctx, target, backupItem.SFTP)
+	if err != nil {
+		return "", err
+	}
+	defer sshClient.Close()
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return "", fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	info, err := client.Stat(target.Path)
+	if err != nil {
+		return "", fmt.Errorf("remote directory %s: %w", target.Path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("remote path %s is not a directory", target.Path)
+	}
+
+	// Для корня сервера архив получает имя хоста
+	baseDir := path.Base(target.Path)
+	if baseDir == "/" {
+		baseDir, _, _ = strings.Cut(target.Addr, ":")
+	}
+
+	var files int
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	name := fmt.Sprintf("%s-%s.tar.gz", backupItem.Name, timestamp)
+	key, err := streamGzip(ctx, name, upload, func(w io.Writer) error {
+		tw, err := newTarWriter(w, baseDir)
+		if err != nil {
+			return err
+		}
+
+		walker := client.Walk(target.Path)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			relPath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), target.Path), "/")
+			if relPath == "" {
+				continue
+			}
+			info := walker.Stat()
+			if excluded(relPath, backupItem.Exclude) {
+				if info.IsDir() {
+					walker.SkipDir()
+				}
+				continue
+			}
+
+			if err := writeSFTPEntry(ctx, client, tw, walker.Path(), relPath, info, limiters); err != nil {
+				return fmt.Errorf("%s: %w", walker.Path(), err)
+			}
+			if info.Mode().IsRegular() {
+				files++
+			}
+		}
+		return tw.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	logging.FromContext(ctx).Info("remote directory archived", "host", target.Addr, "path", target.Path, "files", files)
+	return key, nil
+}
+
+// writeSFTPEntry добавляет в архив обычный файл или символическую ссылку; директории и
+// специальные файлы пропускаются, как и в TarFolder
+func writeSFTPEntry(ctx context.Context, client *sftp.Client, tw *tarWriter, remotePath, relPath string, info fs.FileInfo, limiters []*throttle.Limiter) error {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := client.ReadLink(remotePath)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("failed to create tar header: %w", err)
+		}
+		sftpOwner(header, info)
+		return tw.WriteFile(header, relPath, nil)
+
+	case info.Mode().IsRegular():
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("failed to create tar header: %w", err)
+		}
+		sftpOwner(header, info)
+
+		file, err := client.Open(remotePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		// Файл, выросший во время чтения, обрезается до размера из заголовка
+		reader := io.LimitReader(&contextReader{ctx: ctx, r: file}, header.Size)
+		return tw.WriteFile(header, relPath, throttle.Reader(ctx, reader, limiters...))
+	}
+	return nil
+}
+
+// sftpOwner переносит владельца файла из атрибутов SFTP в заголовок
+func sftpOwner(header *tar.Header, info fs.FileInfo) {
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		header.Uid, header.Gid = int(stat.UID), int(stat.GID)
+	}
+}
+
+// dialSSH подключается к серверу с проверкой ключа хоста по known_hosts
+func dialSSH(ctx context.Context, target *SFTPTarget, opts config.SFTPOptions) (*ssh.Client, error) {
+	knownHostsFile := opts.KnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	auth, closeAuth, err := sshAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuth()
+
+	dialer := net.Dialer{Timeout: sftpDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target.Addr, err)
+	}
+	// Отмена контекста обрывает соединение, прерывая рукопожатие и передачу файлов
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	conn.SetDeadline(time.Now().Add(sftpDialTimeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, target.Addr, &ssh.ClientConfig{
+		User:            target.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("SSH handshake with %s failed: %w", target.Addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	go func() {
+		client.Wait()
+		stop()
+	}()
+	return client, nil
+}
+
+// sshAuth возвращает способ аутентификации: ключ из key-file или ssh-agent.
+// Возвращаемая функция закрывает соединение с агентом после рукопожатия.
+func sshAuth(opts config.SFTPOptions) (ssh.AuthMethod, func(), error) {
+	if opts.KeyFile != "" {
+		pem, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		var signer ssh.Signer
+		if opts.KeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(opts.KeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid SSH key %s: %w", opts.KeyFile, err)
+		}
+		return ssh.PublicKeys(signer), func() {}, nil
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, fmt.Errorf("no SSH key-file configured and SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), func() { conn.Close() }, nil
+}
@@ -0,0 +1,285 @@
+package backup
+
+import (
+	"archive/tar"
+	"backup-to-minio/internal/config"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newSigner создает ключ ed25519 и возвращает его вместе с закрытым ключом в формате OpenSSH
+func newSigner(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, pem.EncodeToMemory(block)
+}
+
+// startSFTPServer запускает SSH-сервер с подсистемой sftp, который пускает только clientKey
+func startSFTPServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	t.Helper()
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, serverConfig)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSSH(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				// Полезная нагрузка subsystem - строка SSH с именем подсистемы
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					return
+				}
+				server.Serve()
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// sftpFixture - запущенный сервер, ключ клиента и known_hosts для него
+type sftpFixture struct {
+	addr       string
+	keyFile    string
+	knownHosts string
+}
+
+// newSFTPFixture поднимает сервер; без trustServerKey в known_hosts записывается чужой ключ
+func newSFTPFixture(t *testing.T, trustServerKey bool) sftpFixture {
+	t.Helper()
+	hostKey, _ := newSigner(t)
+	clientKey, clientPEM := newSigner(t)
+	addr := startSFTPServer(t, hostKey, clientKey.PublicKey())
+
+	dir := t.TempDir()
+	fixture := sftpFixture{
+		addr:       addr,
+		keyFile:    filepath.Join(dir, "id_ed25519"),
+		knownHosts: filepath.Join(dir, "known_hosts"),
+	}
+	if err := os.WriteFile(fixture.keyFile, clientPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	known := hostKey.PublicKey()
+	if !trustServerKey {
+		// Для адреса сервера записан другой ключ, как после подмены хоста
+		other, _ := newSigner(t)
+		known = other.PublicKey()
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, known) + "\n"
+	if err := os.WriteFile(fixture.knownHosts, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fixture
+}
+
+func (f sftpFixture) item(remoteDir string, exclude ...string) config.ConfigBackup {
+	return config.ConfigBackup{
+		Name:    "web1-nginx",
+		Type:    "ssh-folder",
+		Source:  "sftp://backup@" + f.addr + filepath.ToSlash(remoteDir),
+		Exclude: exclude,
+		SFTP:    config.SFTPOptions{KeyFile: f.keyFile, KnownHosts: f.knownHosts},
+	}
+}
+
+// writeTree создает дерево файлов в dir; ключи - относительные пути
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBackupSFTP(t *testing.T) {
+	fixture := newSFTPFixture(t, true)
+
+	remoteDir := filepath.Join(t.TempDir(), "nginx")
+	writeTree(t, remoteDir, map[string]string{
+		"nginx.conf":            "worker_processes auto;",
+		"conf.d/site.conf":      "server { listen 80; }",
+		"conf.d/access.log":     "excluded by *.log at any depth",
+		"cache/entry":           "excluded with its directory",
+		"sites/cache/entry.txt": "excluded: cache matches the directory name",
+		"error.log":             "excluded",
+	})
+	if err := os.Symlink("conf.d/site.conf", filepath.Join(remoteDir, "default")); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	var objectName string
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		objectName = name
+		_, err := io.Copy(&archive, r)
+		return "project/web1/" + name, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	key, err := BackupSFTP(ctx, fixture.item(remoteDir, "*.log", "cache"), upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "project/web1/"+objectName || !strings.HasPrefix(objectName, "web1-nginx-") || !strings.HasSuffix(objectName, ".tar.gz") {
+		t.Errorf("unexpected object %q (key %q)", objectName, key)
+	}
+
+	gzr, err := gzip.NewReader(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+	entries := make(map[string]string)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			entries[header.Name] = "-> " + header.Linkname
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[header.Name] = string(data)
+		}
+	}
+
+	sort.Strings(names)
+	want := []string{"nginx/", "nginx/conf.d/site.conf", "nginx/default", "nginx/nginx.conf"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("archive entries = %v, want %v", names, want)
+	}
+	if entries["nginx/nginx.conf"] != "worker_processes auto;" || entries["nginx/default"] != "-> conf.d/site.conf" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
+
+func TestBackupSFTPHostKey(t *testing.T) {
+	remoteDir := t.TempDir()
+	writeTree(t, remoteDir, map[string]string{"secret.conf": "must not be read"})
+
+	upload := func(ctx context.Context, name string, r io.Reader) (string, error) {
+		t.Errorf("unexpected upload of %s", name)
+		return "", nil
+	}
+
+	t.Run("changed key", func(t *testing.T) {
+		fixture := newSFTPFixture(t, false)
+		_, err := BackupSFTP(context.Background(), fixture.item(remoteDir), upload)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+			t.Fatalf("expected host key mismatch, got %v", err)
+		}
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		fixture := newSFTPFixture(t, true)
+		if err := os.WriteFile(fixture.knownHosts, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := BackupSFTP(context.Background(), fixture.item(remoteDir), upload)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) != 0 {
+			t.Fatalf("expected unknown host key error, got %v", err)
+		}
+	})
+}
+
+func TestSFTPSourceHost(t *testing.T) {
+	for _, typ := range []string{"sftp", "ssh-folder"} {
+		item := config.ConfigBackup{Type: typ, Source: "sftp://backup@web1.local/etc/nginx"}
+		if host := SourceHost(item); host != "web1.local:22" {
+			t.Errorf("SourceHost(%s) = %q", typ, host)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"backup-to-minio/internal/logging"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteBusyTimeout - время ожидания блокировки, пока приложение пишет в базу
+const sqliteBusyTimeout = 30 * time.Second
+
+// BackupSQLite создает согласованную копию базы SQLite командой VACUUM INTO,
+// проверяет копию PRAGMA integrity_check и сжимает ее.
+// Исходная база открывается только для чтения и не блокирует приложение дольше одной транзакции чтения.
+func BackupSQLite(ctx context.Context, name, source, outputDir string) (string, error) {
+	source = strings.TrimPrefix(source, "file:")
+	if _, err := os.Stat(source); err != nil {
+		return "", fmt.Errorf("database file not found: %w", err)
+	}
+
+	timestamp := time.Now().Format("2006-01-02T15-04-05Z")
+	copyPath := filepath.Join(outputDir, fmt.Sprintf("%s-%s.sqlite", name, timestamp))
+
+	db, err := sql.Open("sqlite", sqliteDSN(source, "ro"))
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", copyPath); err != nil {
+		return "", fmt.Errorf("VACUUM INTO failed: %w", err)
+	}
+
+	if err := checkSQLiteIntegrity(ctx, copyPath); err != nil {
+		return "", err
+	}
+	logging.FromContext(ctx).Debug("SQLite integrity check passed", "path", copyPath)
+
+	archiveName, err := GzFile(copyPath)
+	if err != nil {
+		return "", fmt.Errorf("compression failed: %w", err)
+	}
+	if err := os.Remove(copyPath); err != nil {
+		logging.FromContext(ctx).Warn("failed to remove temp file", "path", copyPath, "error", err)
+	}
+
+	return archiveName, nil
+}
+
+// checkSQLiteIntegrity выполняет PRAGMA integrity_check для копии базы
+func checkSQLiteIntegrity(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", sqliteDSN(path, "ro"))
+	if err != nil {
+		return fmt.Errorf("failed to open backup copy: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("integrity check failed: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sqliteDSN возвращает строку подключения modernc.org/sqlite к файлу в указанном режиме
+func sqliteDSN(path, mode string) string {
+	query := url.Values{}
+	query.Set("mode", mode)
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + "?" + query.Encode()
+}
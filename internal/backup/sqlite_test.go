@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openSQLite открывает базу на запись так же, как приложение
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", sqliteDSN(path, "rwc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func execSQLite(t *testing.T, db *sql.DB, queries ...string) {
+	t.Helper()
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+}
+
+func TestBackupSQLite(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.db")
+	db := openSQLite(t, source)
+	execSQLite(t, db,
+		"PRAGMA journal_mode=WAL",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER NOT NULL)",
+		"CREATE TABLE ledger (order_id INTEGER NOT NULL REFERENCES orders(id), amount INTEGER NOT NULL)",
+		"CREATE INDEX ledger_order ON ledger (order_id)",
+	)
+
+	// Приложение пишет в базу во время снимка; каждая транзакция добавляет заказ и проводку
+	var wg sync.WaitGroup
+	var written atomic.Int64
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := tx.Exec("INSERT INTO orders (id, total) VALUES (?, ?)", i, i*10); err != nil {
+				t.Error(err)
+				tx.Rollback()
+				return
+			}
+			if _, err := tx.Exec("INSERT INTO ledger (order_id, amount) VALUES (?, ?)", i, i*10); err != nil {
+				t.Error(err)
+				tx.Rollback()
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+			written.Add(1)
+		}
+	}()
+	for written.Load() < 200 && !t.Failed() {
+		time.Sleep(time.Millisecond)
+	}
+
+	outputDir := t.TempDir()
+	archive, err := BackupSQLite(context.Background(), "app", "file:"+source, outputDir)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(archive) != outputDir || !strings.HasPrefix(filepath.Base(archive), "app-") || !strings.HasSuffix(archive, ".sqlite.gz") {
+		t.Errorf("unexpected archive %s", archive)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(archive, ".gz")); !os.IsNotExist(err) {
+		t.Errorf("uncompressed copy was not removed: %v", err)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored.db")
+	if err := gunzipFile(archive, restored); err != nil {
+		t.Fatalf("archive is not gzipped: %v", err)
+	}
+	if err := checkSQLiteIntegrity(context.Background(), restored); err != nil {
+		t.Fatal(err)
+	}
+
+	// Копия согласована: в нее попадают только целые транзакции
+	copyDB := openSQLite(t, restored)
+	var orders, entries, unmatched int64
+	if err := copyDB.QueryRow("SELECT count(*) FROM orders").Scan(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDB.QueryRow("SELECT count(*) FROM ledger").Scan(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyDB.QueryRow("SELECT count(*) FROM orders o LEFT JOIN ledger l ON l.order_id = o.id WHERE l.amount IS NULL OR l.amount != o.total").Scan(&unmatched); err != nil {
+		t.Fatal(err)
+	}
+	if orders < 200 || orders > written.Load() || entries != orders || unmatched != 0 {
+		t.Errorf("copy has %d orders, %d ledger entries, %d unmatched (%d written)", orders, entries, unmatched, written.Load())
+	}
+}
+
+func TestBackupSQLiteMissingFile(t *testing.T) {
+	_, err := BackupSQLite(context.Background(), "app", filepath.Join(t.TempDir(), "missing.db"), t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "database file not found") {
+		t.Fatalf("expected missing file error, got %v", err)
+	}
+}
+
+func TestCheckSQLiteIntegrityCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "copy.sqlite")
+	db := openSQLite(t, path)
+	execSQLite(t, db,
+		"PRAGMA page_size=4096",
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)",
+		"CREATE INDEX items_name ON items (name)",
+		"WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 2000) INSERT INTO items SELECT i, printf('item-%05d', i) FROM n",
+	)
+	if err := checkSQLiteIntegrity(context.Background(), path); err != nil {
+		t.Fatalf("intact copy: %v", err)
+	}
+	db.Close()
+
+	// Портим страницы данных за заголовком и схемой, как при обрыве записи копии
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 3 * 4096; i < len(data) && i < 6*4096; i++ {
+		data[i] = 0x5a
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkSQLiteIntegrity(context.Background(), path)
+	if err == nil || !strings.HasPrefix(err.Error(), "integrity check failed") {
+		t.Fatalf("expected integrity check error, got %v", err)
+	}
+}
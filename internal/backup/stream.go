@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// errUploadAborted возвращается источнику потока, если загрузка прервалась раньше него
+var errUploadAborted = errors.New("upload aborted")
+
+// streamUploader загружает поток в бакет под именем name внутри пути бэкапа и возвращает полный ключ объекта
+type streamUploader func(ctx context.Context, name string, r io.Reader) (string, error)
+
+// streamTool выполняет утилиту и загружает ее stdout в бакет под именем name без промежуточного файла.
+// Если утилита завершилась с ошибкой, поток обрывается до EOF и загрузка отменяется,
+// поэтому неполный архив в бакет не попадает. Возвращает полный ключ объекта.
+func streamTool(ctx context.Context, cmd *exec.Cmd, name string, upload streamUploader) (string, error) {
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+
+	toolErr := make(chan error, 1)
+	go func() {
+		err := runTool(ctx, cmd)
+		pw.CloseWithError(err)
+		toolErr <- err
+	}()
+
+	key, err := upload(ctx, name, pr)
+	// При ошибке загрузки утилита получает ошибку записи и завершается
+	pr.CloseWithError(errUploadAborted)
+	if toolError := <-toolErr; toolError != nil {
+		return "", toolError
+	}
+	if err != nil {
+		return "", fmt.Errorf("minio upload failed: %w", err)
+	}
+	return key, nil
+}
+
+// streamGzip сжимает данные, которые write записывает в поток, и загружает их в бакет под именем name.
+// Ошибка write отменяет загрузку. Возвращает полный ключ объекта.
+func streamGzip(ctx context.Context, name string, upload streamUploader, write func(w io.Writer) error) (string, error) {
+	pr, pw := io.Pipe()
+
+	writeErr := make(chan error, 1)
+	go func() {
+		gzw := gzip.NewWriter(pw)
+		err := write(gzw)
+		if err == nil {
+			err = gzw.Close()
+		}
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	key, err := upload(ctx, name, pr)
+	pr.CloseWithError(errUploadAborted)
+	if werr := <-writeErr; werr != nil && !errors.Is(werr, errUploadAborted) {
+		return "", werr
+	}
+	if err != nil {
+		return "", fmt.Errorf("minio upload failed: %w", err)
+	}
+	return key, nil
+}
@@ -2,16 +2,69 @@ package backup
 
 import (
 	"archive/tar"
+	"backup-to-minio/internal/throttle"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 )
 
+// tarWriter записывает файлы в tar-архив внутри общей корневой папки
+type tarWriter struct {
+	tw      *tar.Writer
+	baseDir string
+}
+
+// newTarWriter создает tar-архив поверх w и добавляет в него корневую папку baseDir
+func newTarWriter(w io.Writer, baseDir string) (*tarWriter, error) {
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     baseDir + "/",
+		Mode:     0755,
+		Typeflag: tar.TypeDir,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return &tarWriter{tw: tw, baseDir: baseDir}, nil
+}
+
+// WriteFile добавляет в архив файл с путем relPath относительно корневой папки.
+// Для записей без содержимого (символические ссылки) r может быть nil.
+func (t *tarWriter) WriteFile(header *tar.Header, relPath string, r io.Reader) error {
+	header.Name = path.Join(t.baseDir, filepath.ToSlash(relPath))
+	if err := t.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if r == nil {
+		return nil
+	}
+	if _, err := io.Copy(t.tw, r); err != nil {
+		return fmt.Errorf("failed to copy file content: %w", err)
+	}
+	return nil
+}
+
+// Close дописывает конец архива
+func (t *tarWriter) Close() error {
+	return t.tw.Close()
+}
+
+// excluded проверяет, попадает ли путь относительно корня бэкапа под правила exclude.
+// Шаблон (синтаксис path.Match) сравнивается с полным относительным путем и с именем файла,
+// поэтому "*.log" исключает журналы на любой глубине, а "cache/*" - содержимое одной папки.
+func excluded(relPath string, patterns []string) bool {
+	relPath = filepath.ToSlash(relPath)
+	return matchesAny(relPath, patterns) || matchesAny(path.Base(relPath), patterns)
+}
+
 // TarFolder сжимает все файлы и папки в указанной директории и возвращает путь к созданному архиву.
-func TarFolder(source, target string) (string, error) {
+// Файлы и папки, попадающие под exclude, пропускаются.
+// Скорость чтения исходных файлов ограничивается переданными ограничителями.
+func TarFolder(ctx context.Context, source, target string, exclude []string, limiters ...*throttle.Limiter) (string, error) {
 	// Создаем файл архива
 	tarfile, err := os.Create(target)
 	if err != nil {
@@ -23,20 +76,12 @@ func TarFolder(source, target string) (string, error) {
 	gzw := gzip.NewWriter(tarfile)
 	defer gzw.Close()
 
-	// Создаем tar-архив
-	tw := tar.NewWriter(gzw)
-	defer tw.Close()
-
-	baseDir := filepath.Base(source)
-
-	// Добавляем корневую папку в архив
-	if err := tw.WriteHeader(&tar.Header{
-		Name:     baseDir + "/",
-		Mode:     0755,
-		Typeflag: tar.TypeDir,
-	}); err != nil {
-		return "", fmt.Errorf("failed to write header: %w", err)
+	// Создаем tar-архив с корневой папкой
+	tw, err := newTarWriter(gzw, filepath.Base(source))
+	if err != nil {
+		return "", err
 	}
+	defer tw.Close()
 
 	// Проходим по всем файлам и папкам в указанной директории
 	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
@@ -44,9 +89,9 @@ func TarFolder(source, target string) (string, error) {
 			return err
 		}
 
-		// Пропускаем директории, так как они будут обработаны рекурсивно
-		if info.IsDir() {
-			return nil
+		// Прерываем обход при отмене контекста
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
 		relPath, err := filepath.Rel(source, path)
@@ -54,18 +99,40 @@ func TarFolder(source, target string) (string, error) {
 			return err
 		}
 
-		// Создаем заголовок для каждого файла
-		header, err := tar.FileInfoHeader(info, relPath)
-		if err != nil {
-			return fmt.Errorf("failed to create tar header: %w", err)
+		if relPath != "." && excluded(relPath, exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		// Устанавливаем имя файла внутри архива
-		header.Name = filepath.Join(baseDir, relPath)
+		// Пропускаем директории, так как они будут обработаны рекурсивно
+		if info.IsDir() {
+			return nil
+		}
 
-		// Записываем заголовок в архив
-		if err := tw.WriteHeader(header); err != nil {
-			return fmt.Errorf("failed to write header: %w", err)
+		// Символические ссылки сохраняются как ссылки, без содержимого
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return fmt.Errorf("failed to create tar header: %w", err)
+			}
+			return tw.WriteFile(header, relPath, nil)
+		}
+
+		// Сокеты, каналы и устройства не архивируются
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// Создаем заголовок для каждого файла
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("failed to create tar header: %w", err)
 		}
 
 		// Открываем файл для чтения
@@ -76,11 +143,7 @@ func TarFolder(source, target string) (string, error) {
 		defer file.Close()
 
 		// Копируем содержимое файла в архив
-		if _, err := io.Copy(tw, file); err != nil {
-			return fmt.Errorf("failed to copy file content: %w", err)
-		}
-
-		return nil
+		return tw.WriteFile(header, relPath, throttle.Reader(ctx, &contextReader{ctx: ctx, r: file}, limiters...))
 	})
 
 	if err != nil {
@@ -90,6 +153,19 @@ func TarFolder(source, target string) (string, error) {
 	return tarfile.Name(), nil
 }
 
+// contextReader прерывает чтение при отмене контекста
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
 // GenerateTarName генерирует имя файла архива с текущей датой и временем в формате ISO 8601.
 func GenerateTarName(baseName string) string {
 	now := time.Now().UTC()
@@ -0,0 +1,382 @@
+package backup
+
+import (
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/minio"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// walChecksumKey - метаданные объекта с SHA-256 исходного (несжатого) WAL-файла
+const walChecksumKey = "Wal-Sha256"
+
+var (
+	// walSegmentPattern соответствует имени WAL-сегмента: таймлайн, лог и номер сегмента
+	walSegmentPattern = regexp.MustCompile(`^[0-9A-F]{24}$`)
+	// walBackupHistoryPattern соответствует файлу истории базового бэкапа: <сегмент>.<смещение>.backup
+	walBackupHistoryPattern = regexp.MustCompile(`^([0-9A-F]{24})\.[0-9A-F]{8}\.backup$`)
+	// baseBackupPattern соответствует архиву базового бэкапа: <имя>-<timestamp>.tar.gz
+	baseBackupPattern = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}Z)\.tar\.gz$`)
+)
+
+// walEncryption возвращает ключ SSE-C для объекта или nil, если шифрование не настроено.
+// Ключ выводится из секрета и ключа объекта, поэтому у каждого сегмента он свой.
+func walEncryption(backupItem config.ConfigBackup, bucketName, key string) (encrypt.ServerSide, error) {
+	if backupItem.WAL.EncryptionKeyEnv == "" {
+		return nil, nil
+	}
+	secret := os.Getenv(backupItem.WAL.EncryptionKeyEnv)
+	if secret == "" {
+		return nil, fmt.Errorf("%s environment variable is not set", backupItem.WAL.EncryptionKeyEnv)
+	}
+	return encrypt.DefaultPBKDF([]byte(secret), []byte(bucketName+key)), nil
+}
+
+// walObject возвращает путь объекта WAL-файла без проекта и его полный ключ
+func walObject(cfg *config.BackupConfig, backupItem config.ConfigBackup, walName string) (string, string) {
+	objectPath := path.Join(backupItem.WALPath(), walName+".gz")
+	return objectPath, path.Join(cfg.Project, objectPath)
+}
+
+// ArchiveWAL сжимает WAL-файл и загружает его в бакет (archive_command).
+// Повторная загрузка того же файла считается успешной, а файл с тем же именем,
+// но другим содержимым - ошибкой, как того требует документация PostgreSQL.
+func ArchiveWAL(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName, walPath, walName string) error {
+	if backupItem.Type != "postgres" {
+		return fmt.Errorf("backup %s is not a postgres backup", backupItem.Name)
+	}
+	walName = filepath.Base(walName)
+
+	checksum, err := fileSHA256(walPath)
+	if err != nil {
+		return fmt.Errorf("failed to read WAL file: %w", err)
+	}
+
+	objectPath, key := walObject(cfg, backupItem, walName)
+	sse, err := walEncryption(backupItem, bucketName, key)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx).With("wal", walName)
+	existing, err := minio.StatObject(ctx, bucketName, key, sse)
+	switch {
+	case err == nil:
+		if existing.Metadata[walChecksumKey] == checksum {
+			logger.Info("WAL file already archived")
+			return nil
+		}
+		return fmt.Errorf("WAL file %s is already archived with different content", walName)
+	case !errors.Is(err, minio.ErrObjectNotFound):
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp("", walName+"-*.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := gzipFileTo(walPath, tmpFile.Name()); err != nil {
+		return fmt.Errorf("compression failed: %w", err)
+	}
+
+	return minio.UploadToMinio(ctx, minio.UploadParams{
+		Project:    cfg.Project,
+		BucketName: bucketName,
+		ObjectPath: objectPath,
+		FilePath:   tmpFile.Name(),
+		Metadata:   map[string]string{walChecksumKey: checksum},
+		Encryption: sse,
+	})
+}
+
+// RestoreWAL скачивает и распаковывает WAL-файл в targetPath (restore_command).
+// Если файла нет в бакете, возвращается ошибка, оборачивающая minio.ErrObjectNotFound.
+func RestoreWAL(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName, walName, targetPath string) error {
+	if backupItem.Type != "postgres" {
+		return fmt.Errorf("backup %s is not a postgres backup", backupItem.Name)
+	}
+	walName = filepath.Base(walName)
+
+	_, key := walObject(cfg, backupItem, walName)
+	sse, err := walEncryption(backupItem, bucketName, key)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp("", walName+"-*.gz")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := minio.DownloadObject(ctx, bucketName, key, tmpFile.Name(), sse); err != nil {
+		return err
+	}
+
+	// Файл появляется под целевым именем только после полной распаковки
+	partPath := targetPath + ".part"
+	if err := gunzipFile(tmpFile.Name(), partPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to decompress WAL file: %w", err)
+	}
+	if err := os.Rename(partPath, targetPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to write WAL file: %w", err)
+	}
+
+	logging.FromContext(ctx).Info("WAL file restored", "wal", walName)
+	return nil
+}
+
+// PruneWAL удаляет WAL-сегменты, которые не нужны для восстановления из самого старого
+// базового бэкапа в бакете. Граница определяется по файлу истории (.backup), который
+// PostgreSQL архивирует после завершения pg_basebackup.
+func PruneWAL(ctx context.Context, cfg *config.BackupConfig, backupItem config.ConfigBackup, bucketName string, dryRun bool) error {
+	if backupItem.Type != "postgres" {
+		return fmt.Errorf("backup %s is not a postgres backup", backupItem.Name)
+	}
+
+	walPrefix := minio.ObjectPrefix(cfg.Project, backupItem.WALPath())
+	objects, err := minio.ListObjects(ctx, bucketName, minio.ObjectPrefix(cfg.Project, backupItem.ObjectPath()))
+	if err != nil {
+		return err
+	}
+
+	// Самый старый базовый бэкап
+	var oldest time.Time
+	var walObjects []minio.ObjectInfo
+	for _, object := range objects {
+		if strings.HasPrefix(object.Key, walPrefix) {
+			walObjects = append(walObjects, object)
+			continue
+		}
+		match := baseBackupPattern.FindStringSubmatch(path.Base(object.Key))
+		if match == nil {
+			continue
+		}
+		// Метка в имени записана в локальном времени хоста, суффикс Z не означает UTC
+		timestamp, err := time.ParseInLocation("2006-01-02T15-04-05Z", match[1], time.Local)
+		if err == nil && (oldest.IsZero() || timestamp.Before(oldest)) {
+			oldest = timestamp
+		}
+	}
+	if len(walObjects) == 0 {
+		// WAL не архивируется в этот бэкап
+		return nil
+	}
+	if oldest.IsZero() {
+		return fmt.Errorf("no base backups found, refusing to prune WAL")
+	}
+
+	// Первый файл истории, начатый не раньше самого старого базового бэкапа, задает границу
+	var boundary string
+	var boundaryTime time.Time
+	for _, object := range walObjects {
+		match := walBackupHistoryPattern.FindStringSubmatch(strings.TrimSuffix(path.Base(object.Key), ".gz"))
+		if match == nil {
+			continue
+		}
+		startTime, err := readBackupHistoryStart(ctx, backupItem, bucketName, object.Key)
+		if err != nil {
+			return fmt.Errorf("backup history %s: %w", path.Base(object.Key), err)
+		}
+		if startTime.Before(oldest) {
+			continue
+		}
+		if boundary == "" || startTime.Before(boundaryTime) {
+			boundary, boundaryTime = match[1], startTime
+		}
+	}
+	if boundary == "" {
+		return fmt.Errorf("no backup history file found for the base backup taken at %s", oldest.Format(time.RFC3339))
+	}
+
+	// Как и pg_archivecleanup, сравниваем имена без таймлайна
+	var keys []string
+	for _, object := range walObjects {
+		name := strings.TrimSuffix(path.Base(object.Key), ".gz")
+		segment := name
+		if match := walBackupHistoryPattern.FindStringSubmatch(name); match != nil {
+			segment = match[1]
+		} else if !walSegmentPattern.MatchString(name) {
+			continue
+		}
+		if segment[8:] < boundary[8:] {
+			keys = append(keys, object.Key)
+		}
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("WAL prune plan",
+		"oldest_base_backup", oldest.Format(time.RFC3339),
+		"first_required_segment", boundary,
+		"objects", len(keys),
+		"dry_run", dryRun,
+	)
+	if dryRun || len(keys) == 0 {
+		return nil
+	}
+
+	if err := minio.RemoveObjects(ctx, bucketName, keys); err != nil {
+		return err
+	}
+	logger.Info("WAL pruned", "objects", len(keys))
+	return nil
+}
+
+// readBackupHistoryStart возвращает START TIME из файла истории базового бэкапа
+func readBackupHistoryStart(ctx context.Context, backupItem config.ConfigBackup, bucketName, key string) (time.Time, error) {
+	sse, err := walEncryption(backupItem, bucketName, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	tmpFile, err := os.CreateTemp("", "wal-history-*.gz")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := minio.DownloadObject(ctx, bucketName, key, tmpFile.Name(), sse); err != nil {
+		return time.Time{}, err
+	}
+
+	file, err := os.Open(tmpFile.Name())
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer gzr.Close()
+
+	scanner := bufio.NewScanner(gzr)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "START TIME: "); ok {
+			return parseBackupHistoryTime(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("START TIME not found")
+}
+
+// parseBackupHistoryTime разбирает START TIME файла истории. PostgreSQL записывает время
+// в часовом поясе log_timezone: с аббревиатурой (UTC, MSK) или смещением (+03, -0330).
+// Аббревиатура, которая не совпадает с UTC или локальным часовым поясом, считается ошибкой:
+// иначе time.Parse молча подставил бы нулевое смещение.
+func parseBackupHistoryTime(value string) (time.Time, error) {
+	const layout = "2006-01-02 15:04:05"
+	dateTime, zone, ok := strings.Cut(value, " ")
+	if ok {
+		var clock string
+		clock, zone, ok = strings.Cut(zone, " ")
+		dateTime += " " + clock
+	}
+	if !ok || zone == "" {
+		return time.Time{}, fmt.Errorf("invalid START TIME %q", value)
+	}
+
+	switch {
+	case zone == "UTC" || zone == "GMT":
+		return time.ParseInLocation(layout, dateTime, time.UTC)
+	case zone[0] == '+' || zone[0] == '-':
+		offset, err := parseZoneOffset(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid START TIME %q: %w", value, err)
+		}
+		return time.ParseInLocation(layout, dateTime, time.FixedZone(zone, offset))
+	}
+
+	t, err := time.ParseInLocation(layout+" MST", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Смещение известно, только если аббревиатура найдена в локальном часовом поясе
+	if t.Location() != time.Local {
+		return time.Time{}, fmt.Errorf("unknown time zone %q in START TIME; set log_timezone to UTC", zone)
+	}
+	return t, nil
+}
+
+// parseZoneOffset возвращает смещение в секундах для записи вида +03, +0530 или -03:30
+func parseZoneOffset(zone string) (int, error) {
+	digits := strings.ReplaceAll(zone[1:], ":", "")
+	if len(digits) != 2 && len(digits) != 4 {
+		return 0, fmt.Errorf("invalid time zone offset %q", zone)
+	}
+	if len(digits) == 2 {
+		digits += "00"
+	}
+	var hours, minutes int
+	if _, err := fmt.Sscanf(digits, "%02d%02d", &hours, &minutes); err != nil || minutes >= 60 {
+		return 0, fmt.Errorf("invalid time zone offset %q", zone)
+	}
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+// fileSHA256 возвращает SHA-256 содержимого файла в шестнадцатеричном виде
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// gzipFileTo сжимает файл source в target
+func gzipFileTo(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gzw := gzip.NewWriter(out)
+	if _, err := io.Copy(gzw, in); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
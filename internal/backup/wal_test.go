@@ -0,0 +1,43 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBackupHistoryTime(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+	local := time.Local
+	time.Local = moscow
+	t.Cleanup(func() { time.Local = local })
+
+	want := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "2024-05-01 09:00:00 UTC"},
+		{value: "2024-05-01 09:00:00 GMT"},
+		{value: "2024-05-01 12:00:00 +03"},
+		{value: "2024-05-01 05:30:00 -0330"},
+		{value: "2024-05-01 14:30:00 +05:30"},
+		{value: "2024-05-01 12:00:00 MSK"},
+		{value: "2024-05-01 11:00:00 CEST", wantErr: true},
+		{value: "2024-05-01 12:00:00 +3", wantErr: true},
+		{value: "2024-05-01 12:00:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseBackupHistoryTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBackupHistoryTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(want) {
+				t.Errorf("parseBackupHistoryTime() = %s, want %s", got.UTC(), want)
+			}
+		})
+	}
+}
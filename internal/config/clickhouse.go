@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// Способы резервного копирования ClickHouse
+const (
+	ClickHouseMethodBackup = "backup" // BACKUP ... TO S3 силами сервера
+	ClickHouseMethodNative = "native" // Выгрузка таблиц в формате Native через HTTP
+)
+
+// ClickHouseOptions задает параметры бэкапа clickhouse; source содержит HTTP-адрес сервера с базой в пути
+type ClickHouseOptions struct {
+	Method        string   `yaml:"method,omitempty"`         // backup или native; по умолчанию backup с переходом на native, если сервер его не поддерживает
+	Tables        []string `yaml:"tables,omitempty"`         // Таблицы для резервного копирования (допускаются шаблоны вида events_*)
+	ExcludeTables []string `yaml:"exclude-tables,omitempty"` // Исключаемые таблицы
+	S3Endpoint    string   `yaml:"s3-endpoint,omitempty"`    // Адрес MinIO, доступный серверу ClickHouse (по умолчанию MINIO_ENDPOINT)
+	// Именованная коллекция сервера с ключами MinIO; без нее сервер берет ключи из настроек <s3> для адреса
+	NamedCollection string `yaml:"named-collection,omitempty"`
+}
+
+// validate проверяет способ выгрузки и шаблоны таблиц
+func (o ClickHouseOptions) validate() error {
+	switch o.Method {
+	case "", ClickHouseMethodBackup, ClickHouseMethodNative:
+	default:
+		return fmt.Errorf("unsupported clickhouse method: %s", o.Method)
+	}
+	for _, pattern := range append(append([]string(nil), o.Tables...), o.ExcludeTables...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid clickhouse table pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCommandExtension - расширение файла вывода команды по умолчанию
+const DefaultCommandExtension = "out"
+
+// CommandOptions задает команду, вывод которой сохраняется бэкапом command
+type CommandOptions struct {
+	Command   string            `yaml:"command"`              // Исполняемый файл
+	Args      []string          `yaml:"args,omitempty"`       // Аргументы; {output_dir} заменяется директорией вывода
+	Env       map[string]string `yaml:"env,omitempty"`        // Дополнительные переменные окружения
+	Dir       string            `yaml:"dir,omitempty"`        // Рабочая директория
+	Extension string            `yaml:"extension,omitempty"`  // Расширение файла вывода (например, ldif или snap)
+	OutputDir bool              `yaml:"output-dir,omitempty"` // Команда пишет файлы в директорию, которая затем архивируется
+}
+
+// validate проверяет параметры команды
+func (o CommandOptions) validate() error {
+	if o.Command == "" {
+		return fmt.Errorf("command is required for command backups")
+	}
+	if strings.ContainsAny(o.Extension, "/\\") {
+		return fmt.Errorf("invalid command extension: %s", o.Extension)
+	}
+	return nil
+}
+
+// FileExtension возвращает расширение файла вывода без ведущей точки
+func (o CommandOptions) FileExtension() string {
+	if ext := strings.TrimPrefix(o.Extension, "."); ext != "" {
+		return ext
+	}
+	return DefaultCommandExtension
+}
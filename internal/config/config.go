@@ -1,26 +1,89 @@
 package config
 
 import (
-	"os"
-	
 	"fmt"
+	"os"
+	"path"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Политики поведения при пересечении запусков одного задания
+const (
+	OverlapSkip  = "skip"  // Пропустить запуск, если предыдущий еще выполняется
+	OverlapQueue = "queue" // Дождаться завершения предыдущего запуска
+	OverlapAllow = "allow" // Разрешить параллельные запуски
+)
+
+// DefaultShutdownGrace - время ожидания выполняющихся бэкапов при остановке по умолчанию
+const DefaultShutdownGrace = 30 * time.Second
+
+// DefaultHookTimeout - максимальная длительность хука, если timeout не задан
+const DefaultHookTimeout = 10 * time.Minute
+
+// Hook описывает команду, выполняемую до или после резервного копирования
+type Hook struct {
+	Command  string            `yaml:"command"`            // Исполняемый файл
+	Args     []string          `yaml:"args,omitempty"`     // Аргументы команды
+	Env      map[string]string `yaml:"env,omitempty"`      // Дополнительные переменные окружения
+	Dir      string            `yaml:"dir,omitempty"`      // Рабочая директория
+	Timeout  time.Duration     `yaml:"timeout,omitempty"`  // Максимальная длительность выполнения
+	Optional bool              `yaml:"optional,omitempty"` // Ошибка хука не прерывает резервное копирование
+}
+
+// Hooks содержит команды, выполняемые на разных этапах резервного копирования
+type Hooks struct {
+	Pre       []Hook `yaml:"pre,omitempty"`        // Перед резервным копированием
+	Post      []Hook `yaml:"post,omitempty"`       // После резервного копирования, независимо от результата
+	OnSuccess []Hook `yaml:"on_success,omitempty"` // После успешного резервного копирования
+	OnFailure []Hook `yaml:"on_failure,omitempty"` // После неудачного резервного копирования
+}
+
 // ConfigBackup представляет один элемент конфигурации резервного копирования
 type ConfigBackup struct {
-	Name     string `yaml:"name"`                // Имя резервной копии
-	Source   string `yaml:"source"`              // Источник данных для резервного копирования (папка или volume)
-	Type     string `yaml:"type"`                // Тип данных ("folder" или "volume")
-	PathSave string `yaml:"path-save,omitempty"` // Путь для сохранения в бакете (опционально)
-	Schedule string `yaml:"schedule,omitempty"`  // Расписание для автоматического резервного копирования
+	Name     string        `yaml:"name"`                // Имя резервной копии
+	Source   string        `yaml:"source"`              // Источник данных для резервного копирования (папка или volume)
+	Type     string        `yaml:"type"`                // Тип данных ("folder" или "volume")
+	PathSave string        `yaml:"path-save,omitempty"` // Путь для сохранения в бакете (опционально)
+	Schedule string        `yaml:"schedule,omitempty"`  // Расписание для автоматического резервного копирования
+	Overlap  string        `yaml:"overlap,omitempty"`   // Поведение при пересечении запусков: skip (по умолчанию), queue или allow
+	Timeout  time.Duration `yaml:"timeout,omitempty"`   // Максимальная длительность одного запуска (например, "2h")
+	Hooks    Hooks         `yaml:"hooks,omitempty"`     // Команды до и после резервного копирования
+	MaxAge   time.Duration `yaml:"max-age,omitempty"`   // Допустимый возраст последней успешной копии для /freshness
+	Throttle Throttle      `yaml:"throttle,omitempty"`  // Ограничения скорости этого бэкапа (действуют вместе с общими)
+	Exclude  []string      `yaml:"exclude,omitempty"`   // Исключаемые файлы и папки для folder и sftp/ssh-folder (шаблоны вида *.log или cache/*)
+
+	Retention Retention `yaml:"retention,omitempty"` // Сколько запусков хранить в бакете
+
+	Databases        []string `yaml:"databases,omitempty"`         // Базы для резервного копирования (по умолчанию база из source или все базы)
+	ExcludeDatabases []string `yaml:"exclude-databases,omitempty"` // Исключаемые базы (допускаются шаблоны вида tenant_*)
+	IncludeUsers     bool     `yaml:"include-users,omitempty"`     // Выгружать пользователей и привилегии (схема mysql)
+	DumpDatabases    bool     `yaml:"dump-databases,omitempty"`    // Выгружать все базы сервера вместе с глобальными объектами (postgres-globals)
+	Driver           string   `yaml:"driver,omitempty"`            // Способ выгрузки: mysqldump (по умолчанию) или native
+	BaseBackup       string   `yaml:"base-backup,omitempty"`       // Полный бэкап, поверх которого применяются binlog-файлы (mysql-binlog)
+
+	WAL      WAL             `yaml:"wal,omitempty"`      // Архивирование WAL для бэкапа postgres
+	Postgres PostgresOptions `yaml:"postgres,omitempty"` // Параметры pg_basebackup
+	MongoDB  MongoOptions    `yaml:"mongodb,omitempty"`  // Параметры mongodump
+	Redis    RedisOptions    `yaml:"redis,omitempty"`    // Способ получения RDB
+	Etcd     EtcdOptions     `yaml:"etcd,omitempty"`     // TLS и аутентификация etcd
+
+	Elasticsearch ElasticsearchOptions `yaml:"elasticsearch,omitempty"` // Снимки Elasticsearch/OpenSearch
+	ClickHouse    ClickHouseOptions    `yaml:"clickhouse,omitempty"`    // Способ выгрузки и фильтр таблиц ClickHouse
+	Command       CommandOptions       `yaml:"command,omitempty"`       // Команда для бэкапа command
+	SFTP          SFTPOptions          `yaml:"sftp,omitempty"`          // Аутентификация SSH для бэкапа sftp/ssh-folder
+	S3            S3Options            `yaml:"s3,omitempty"`            // Сервер источника и хранение удаленных объектов для бэкапа s3
 }
 
 // BackupConfig представляет полную конфигурацию резервного копирования
 type BackupConfig struct {
-	Project string         `yaml:"project"`  // Глобальное имя проекта
-	Backups []ConfigBackup `yaml:"backups"`  // Список всех резервных копий
+	Project       string         `yaml:"project"`                  // Глобальное имя проекта
+	MaxConcurrent int            `yaml:"max-concurrent,omitempty"` // Максимум одновременно выполняемых бэкапов (0 - без ограничений)
+	MaxPerHost    int            `yaml:"max-per-host,omitempty"`   // Максимум одновременных бэкапов с одного хоста источника (0 - без ограничений)
+	ShutdownGrace time.Duration  `yaml:"shutdown-grace,omitempty"` // Время ожидания выполняющихся бэкапов при остановке (по умолчанию 30s)
+	Throttle      Throttle       `yaml:"throttle,omitempty"`       // Общие ограничения скорости всех бэкапов (все загрузки идут в один бакет MinIO)
+	Backups       []ConfigBackup `yaml:"backups"`                  // Список всех резервных копий
 }
 
 // LoadConfig загружает конфигурацию резервного копирования из YAML файла
@@ -42,5 +105,97 @@ func LoadConfig(filePath string) (*BackupConfig, error) {
 		return nil, fmt.Errorf("project name is required in config")
 	}
 
+	if config.MaxConcurrent < 0 || config.MaxPerHost < 0 {
+		return nil, fmt.Errorf("max-concurrent and max-per-host must not be negative")
+	}
+
+	if err := config.Throttle.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.ShutdownGrace == 0 {
+		config.ShutdownGrace = DefaultShutdownGrace
+	}
+
+	for _, item := range config.Backups {
+		switch item.Overlap {
+		case "", OverlapSkip, OverlapQueue, OverlapAllow:
+		default:
+			return nil, fmt.Errorf("backup %s: unsupported overlap policy: %s", item.Name, item.Overlap)
+		}
+
+		if err := item.Throttle.validate(); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		if err := item.Retention.validate(item); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		if err := item.Postgres.validate(); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		if item.S3.KeepDeleted < 0 {
+			return nil, fmt.Errorf("backup %s: s3 keep-deleted must not be negative", item.Name)
+		}
+
+		if item.Elasticsearch.Keep < 0 || item.Elasticsearch.KeepFor < 0 {
+			return nil, fmt.Errorf("backup %s: elasticsearch keep and keep-for must not be negative", item.Name)
+		}
+
+		if err := item.MongoDB.validate(); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		if err := item.ClickHouse.validate(); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+		}
+
+		for _, pattern := range item.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("backup %s: invalid exclude pattern %q: %w", item.Name, pattern, err)
+			}
+		}
+
+		if item.Type == "command" {
+			if err := item.Command.validate(); err != nil {
+				return nil, fmt.Errorf("backup %s: %w", item.Name, err)
+			}
+		}
+
+		if item.BaseBackup != "" {
+			if base, ok := config.Backup(item.BaseBackup); !ok || base.Type != "mysql" {
+				return nil, fmt.Errorf("backup %s: base-backup must name a mysql backup", item.Name)
+			}
+		}
+
+		for _, hooks := range [][]Hook{item.Hooks.Pre, item.Hooks.Post, item.Hooks.OnSuccess, item.Hooks.OnFailure} {
+			for _, hook := range hooks {
+				if hook.Command == "" {
+					return nil, fmt.Errorf("backup %s: hook command is required", item.Name)
+				}
+			}
+		}
+	}
+
 	return &config, nil
-}
\ No newline at end of file
+}
+
+// ObjectPath возвращает путь для сохранения резервных копий в бакете (без проекта)
+func (b ConfigBackup) ObjectPath() string {
+	if b.PathSave != "" {
+		return b.PathSave
+	}
+	return b.Name
+}
+
+// Backup возвращает элемент конфигурации по имени
+func (c *BackupConfig) Backup(name string) (ConfigBackup, bool) {
+	for _, item := range c.Backups {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return ConfigBackup{}, false
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// ElasticsearchOptions задает параметры снимков Elasticsearch/OpenSearch
+type ElasticsearchOptions struct {
+	Repository         string         `yaml:"repository,omitempty"`           // Имя репозитория снимков (по умолчанию имя бэкапа)
+	Client             string         `yaml:"client,omitempty"`               // Имя S3-клиента в настройках кластера (по умолчанию default)
+	RepositorySettings map[string]any `yaml:"repository-settings,omitempty"`  // Дополнительные настройки репозитория
+	Indices            []string       `yaml:"indices,omitempty"`              // Индексы или шаблоны (по умолчанию все)
+	IncludeGlobalState bool           `yaml:"include-global-state,omitempty"` // Сохранять состояние кластера (шаблоны, настройки)
+	Keep               int            `yaml:"keep,omitempty"`                 // Сколько последних снимков хранить (0 - все)
+	KeepFor            time.Duration  `yaml:"keep-for,omitempty"`             // Удалять снимки старше этого срока (0 - не удалять)
+	APIKey             string         `yaml:"api-key,omitempty"`              // Ключ API вместо логина и пароля в source
+	CAFile             string         `yaml:"ca-file,omitempty"`              // Сертификат CA для проверки кластера
+}
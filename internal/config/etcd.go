@@ -0,0 +1,10 @@
+package config
+
+// EtcdOptions задает параметры подключения к etcd; source содержит адреса через запятую
+type EtcdOptions struct {
+	CertFile string `yaml:"cert-file,omitempty"` // Клиентский сертификат TLS
+	KeyFile  string `yaml:"key-file,omitempty"`  // Ключ клиентского сертификата
+	CAFile   string `yaml:"ca-file,omitempty"`   // Сертификат CA для проверки сервера
+	Username string `yaml:"username,omitempty"`  // Пользователь (если включена аутентификация)
+	Password string `yaml:"password,omitempty"`
+}
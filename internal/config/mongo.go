@@ -0,0 +1,22 @@
+package config
+
+import "fmt"
+
+// MongoOptions задает параметры mongodump для бэкапа mongodb
+type MongoOptions struct {
+	Oplog              bool     `yaml:"oplog,omitempty"`               // Снимок на момент окончания выгрузки (--oplog, только весь replica set)
+	ReadPreference     string   `yaml:"read-preference,omitempty"`     // Узел для чтения: primary, secondary, secondaryPreferred, ...
+	Collection         string   `yaml:"collection,omitempty"`          // Выгружать только одну коллекцию (требует базу в source)
+	ExcludeCollections []string `yaml:"exclude-collections,omitempty"` // Исключаемые коллекции (требует базу в source)
+}
+
+// validate проверяет совместимость параметров mongodump
+func (o MongoOptions) validate() error {
+	if o.Collection != "" && len(o.ExcludeCollections) > 0 {
+		return fmt.Errorf("mongodb collection and exclude-collections cannot be combined")
+	}
+	if o.Oplog && (o.Collection != "" || len(o.ExcludeCollections) > 0) {
+		return fmt.Errorf("mongodb oplog requires a full dump without collection filters")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Допустимые значения параметров pg_basebackup
+var (
+	postgresWALMethods        = []string{"none", "fetch", "stream"}
+	postgresManifestChecksums = []string{"NONE", "CRC32C", "SHA224", "SHA256", "SHA384", "SHA512"}
+)
+
+// Границы --max-rate, которые принимает pg_basebackup
+const (
+	postgresMinRate ByteRate = 32 << 10
+	postgresMaxRate ByteRate = 1 << 30
+)
+
+// PostgresOptions задает параметры pg_basebackup для бэкапа postgres
+type PostgresOptions struct {
+	WALMethod         string   `yaml:"wal-method,omitempty"`         // none, fetch или stream (по умолчанию stream)
+	Slot              string   `yaml:"slot,omitempty"`               // Слот репликации для потоковой передачи WAL
+	FastCheckpoint    bool     `yaml:"fast-checkpoint,omitempty"`    // Немедленная контрольная точка вместо распределенной
+	MaxRate           ByteRate `yaml:"max-rate,omitempty"`           // Ограничение скорости передачи данных сервером (от 32KiB до 1GiB)
+	ManifestChecksums string   `yaml:"manifest-checksums,omitempty"` // Алгоритм контрольных сумм манифеста (NONE, CRC32C, SHA256, ...)
+}
+
+// validate проверяет параметры pg_basebackup
+func (o PostgresOptions) validate() error {
+	if o.WALMethod != "" && !slices.Contains(postgresWALMethods, o.WALMethod) {
+		return fmt.Errorf("unsupported postgres wal-method: %s", o.WALMethod)
+	}
+	if o.Slot != "" && o.WALMethod != "" && o.WALMethod != "stream" {
+		return fmt.Errorf("postgres slot requires wal-method stream")
+	}
+	if o.MaxRate != 0 && (o.MaxRate < postgresMinRate || o.MaxRate > postgresMaxRate) {
+		return fmt.Errorf("postgres max-rate must be between 32KiB and 1GiB")
+	}
+	if o.ManifestChecksums != "" && !slices.Contains(postgresManifestChecksums, strings.ToUpper(o.ManifestChecksums)) {
+		return fmt.Errorf("unsupported postgres manifest-checksums: %s", o.ManifestChecksums)
+	}
+	return nil
+}
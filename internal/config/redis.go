@@ -0,0 +1,7 @@
+package config
+
+// RedisOptions задает способ получения RDB для бэкапа redis
+type RedisOptions struct {
+	RDBPath   string `yaml:"rdb-path,omitempty"`    // Локальный путь к dump.rdb: BGSAVE и копирование файла (иначе снимок по протоколу репликации)
+	TLSCAFile string `yaml:"tls-ca-file,omitempty"` // Сертификат CA для проверки сервера при rediss://
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// unmanagedTypes - типы, объекты которых не принадлежат одному запуску: снимки Elasticsearch
+// удаляются через API кластера (elasticsearch.keep), зеркало s3 и binlog-файлы хранятся по своим правилам
+var unmanagedTypes = []string{"elasticsearch", "s3", "mysql-binlog"}
+
+// Retention задает хранение запусков бэкапа в бакете. Запуск удаляется целиком,
+// учитываются только объекты с манифестом
+type Retention struct {
+	Keep    int           `yaml:"keep,omitempty"`     // Сколько последних запусков хранить (0 - все)
+	KeepFor time.Duration `yaml:"keep-for,omitempty"` // Удалять запуски старше этого срока (0 - не удалять)
+}
+
+// Enabled сообщает, задано ли хранение
+func (r Retention) Enabled() bool {
+	return r.Keep > 0 || r.KeepFor > 0
+}
+
+// RunObjects сообщает, что объекты бэкапа целиком создаются запуском: для таких типов
+// считается размер запуска и доступно хранение по retention
+func (b ConfigBackup) RunObjects() bool {
+	return !slices.Contains(unmanagedTypes, b.Type)
+}
+
+// HasManifests сообщает, записываются ли для объектов бэкапа манифесты: только при заданном
+// retention, чтобы без него содержимое бакета не менялось
+func (b ConfigBackup) HasManifests() bool {
+	return b.RunObjects() && b.Retention.Enabled()
+}
+
+// validate проверяет параметры хранения
+func (r Retention) validate(b ConfigBackup) error {
+	if r.Keep < 0 || r.KeepFor < 0 {
+		return fmt.Errorf("retention keep and keep-for must not be negative")
+	}
+	if r.Enabled() && !b.RunObjects() {
+		return fmt.Errorf("retention is not supported for %s backups", b.Type)
+	}
+	return nil
+}
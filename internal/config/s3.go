@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+// DefaultKeepDeleted - сколько хранятся копии удаленных из источника объектов, если keep-deleted не задан
+const DefaultKeepDeleted = 30 * 24 * time.Hour
+
+// S3Options задает параметры зеркалирования бакета для бэкапа s3.
+// source имеет вид s3://bucket/prefix (тот же MinIO) или https://host/bucket/prefix (другой сервер).
+type S3Options struct {
+	AccessKey   string        `yaml:"access-key,omitempty"`   // Ключ доступа к серверу источника (для другого сервера)
+	SecretKey   string        `yaml:"secret-key,omitempty"`   // Секретный ключ сервера источника
+	Region      string        `yaml:"region,omitempty"`       // Регион сервера источника
+	KeepDeleted time.Duration `yaml:"keep-deleted,omitempty"` // Сколько хранить копии удаленных из источника объектов (по умолчанию 30 дней)
+}
+
+// KeepDeletedFor возвращает срок хранения копий удаленных из источника объектов
+func (o S3Options) KeepDeletedFor() time.Duration {
+	if o.KeepDeleted > 0 {
+		return o.KeepDeleted
+	}
+	return DefaultKeepDeleted
+}
@@ -0,0 +1,9 @@
+package config
+
+// SFTPOptions задает аутентификацию для бэкапа sftp; source имеет вид sftp://user@host:22/path.
+// Без key-file используется ssh-agent из SSH_AUTH_SOCK.
+type SFTPOptions struct {
+	KeyFile       string `yaml:"key-file,omitempty"`       // Закрытый ключ SSH
+	KeyPassphrase string `yaml:"key-passphrase,omitempty"` // Пароль закрытого ключа
+	KnownHosts    string `yaml:"known-hosts,omitempty"`    // Файл known_hosts (по умолчанию ~/.ssh/known_hosts)
+}
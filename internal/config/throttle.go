@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"gopkg.in/yaml.v3"
+)
+
+// ByteRate задает скорость в байтах в секунду; в YAML допускаются значения вида "10MiB" или "512KB/s"
+type ByteRate int64
+
+// UnmarshalYAML разбирает скорость с единицами измерения
+func (r *ByteRate) UnmarshalYAML(value *yaml.Node) error {
+	text := strings.TrimSuffix(strings.TrimSpace(value.Value), "/s")
+	if text == "" || text == "0" {
+		*r = 0
+		return nil
+	}
+	bytes, err := humanize.ParseBytes(text)
+	if err != nil {
+		return fmt.Errorf("invalid byte rate %q: %w", value.Value, err)
+	}
+	*r = ByteRate(bytes)
+	return nil
+}
+
+// ThrottleWindow переопределяет ограничения скорости в интервале времени суток
+type ThrottleWindow struct {
+	From        string   `yaml:"from"`                   // Начало интервала в формате HH:MM (локальное время)
+	To          string   `yaml:"to"`                     // Конец интервала в формате HH:MM; может быть меньше From (через полночь)
+	UploadLimit ByteRate `yaml:"upload-limit,omitempty"` // Скорость загрузки в интервале (0 - без ограничений)
+	ReadLimit   ByteRate `yaml:"read-limit,omitempty"`   // Скорость чтения в интервале (0 - без ограничений)
+}
+
+// Throttle задает ограничения скорости загрузки в MinIO и чтения при архивации
+type Throttle struct {
+	UploadLimit ByteRate         `yaml:"upload-limit,omitempty"` // Скорость загрузки вне интервалов (0 - без ограничений)
+	ReadLimit   ByteRate         `yaml:"read-limit,omitempty"`   // Скорость чтения файлов вне интервалов (0 - без ограничений)
+	Schedule    []ThrottleWindow `yaml:"schedule,omitempty"`     // Интервалы времени суток с другими ограничениями
+}
+
+// validate проверяет формат интервалов расписания
+func (t Throttle) validate() error {
+	for _, window := range t.Schedule {
+		if _, err := time.Parse("15:04", window.From); err != nil {
+			return fmt.Errorf("invalid throttle window start %q: expected HH:MM", window.From)
+		}
+		if _, err := time.Parse("15:04", window.To); err != nil {
+			return fmt.Errorf("invalid throttle window end %q: expected HH:MM", window.To)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package config
+
+import "path"
+
+// DefaultWALPath - папка WAL-сегментов внутри path-save бэкапа postgres
+const DefaultWALPath = "wal"
+
+// WAL задает архивирование WAL-сегментов PostgreSQL (команды archive-wal и restore-wal)
+type WAL struct {
+	Path             string `yaml:"path,omitempty"`               // Папка внутри path-save (по умолчанию wal)
+	EncryptionKeyEnv string `yaml:"encryption-key-env,omitempty"` // Переменная окружения с ключом шифрования SSE-C (пусто - без шифрования)
+}
+
+// WALPath возвращает путь к WAL-сегментам бэкапа в бакете (без проекта)
+func (b ConfigBackup) WALPath() string {
+	if b.WAL.Path != "" {
+		return path.Join(b.ObjectPath(), b.WAL.Path)
+	}
+	return path.Join(b.ObjectPath(), DefaultWALPath)
+}
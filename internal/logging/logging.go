@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// loggerKey - ключ логгера в контексте
+type loggerKey struct{}
+
+// Setup настраивает глобальный логгер: формат text или json и уровень debug, info, warn или error
+func Setup(w io.Writer, format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// WithLogger возвращает контекст с логгером, который используют все этапы резервного копирования
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext возвращает логгер из контекста или глобальный логгер, если он не задан
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithStage возвращает контекст, логгер которого помечает записи этапом резервного копирования
+func WithStage(ctx context.Context, stage string) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With("stage", stage))
+}
+
+// Tee возвращает обработчик, передающий записи во все указанные обработчики
+func Tee(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+// teeHandler передает записи нескольким обработчикам
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var firstErr error
+	for _, h := range t {
+		if !h.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, record.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
@@ -1,31 +1,47 @@
 package minio
 
 import (
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/throttle"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 )
 
 // UploadParams содержит параметры для загрузки в MinIO
 type UploadParams struct {
-	Project    string // Имя проекта (ybex)
-	BucketName string // Название бакета
-	ObjectPath string // Путь к объекту в бакете (без проекта)
-	FilePath   string // Локальный путь к файлу
+	Project    string    // Имя проекта (ybex)
+	BucketName string    // Название бакета
+	ObjectPath string    // Путь к объекту в бакете (без проекта)
+	FilePath   string    // Локальный путь к файлу
+	Reader     io.Reader // Поток данных вместо файла; FilePath тогда не нужен
+	Size       int64     // Размер потока Reader, если он известен заранее (0 - неизвестен)
+
+	Throttle []*throttle.Limiter // Ограничители скорости загрузки (nil - без ограничений)
+
+	Metadata   map[string]string  // Дополнительные пользовательские метаданные объекта
+	Encryption encrypt.ServerSide // Шифрование на стороне сервера (nil - без шифрования)
 }
 
-// UploadToMinio загружает файл в MinIO с учетом структуры проекта
-func UploadToMinio(params UploadParams) error {
-	// Валидация параметров
-	if params.Project == "" || params.BucketName == "" || params.ObjectPath == "" || params.FilePath == "" {
-		return fmt.Errorf("all upload parameters must be specified")
-	}
+// ErrObjectNotFound возвращается, если запрошенного объекта нет в бакете
+var ErrObjectNotFound = errors.New("object not found")
 
+// cleanupTimeout ограничивает время удаления незавершенной загрузки после ошибки
+const cleanupTimeout = 30 * time.Second
+
+// newClient создает клиент MinIO по настройкам из окружения
+func newClient() (*minio.Client, error) {
 	// Получение настроек из окружения
 	endpoint := os.Getenv("MINIO_ENDPOINT")
 	accessKeyID := os.Getenv("MINIO_ACCESS_KEY")
@@ -38,10 +54,170 @@ func UploadToMinio(params UploadParams) error {
 		Secure: useSSL,
 	})
 	if err != nil {
-		return fmt.Errorf("minio initialization failed: %v", err)
+		return nil, fmt.Errorf("minio initialization failed: %v", err)
+	}
+	return minioClient, nil
+}
+
+// EndpointURL возвращает адрес MinIO со схемой для передачи серверам, которые пишут в бакет сами
+func EndpointURL() string {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	if os.Getenv("MINIO_USE_SSL") == "true" {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
+// ObjectInfo описывает объект в бакете
+type ObjectInfo struct {
+	Key          string    // Полный ключ объекта
+	Size         int64     // Размер в байтах
+	LastModified time.Time // Время последнего изменения
+	StorageClass string    // Класс хранения
+
+	Metadata map[string]string // Пользовательские метаданные (заполняются только StatObject)
+}
+
+// ObjectPrefix возвращает префикс объектов резервной копии в бакете
+func ObjectPrefix(project, objectPath string) string {
+	return strings.TrimSuffix(path.Join(project, filepath.ToSlash(objectPath)), "/") + "/"
+}
+
+// ListObjects возвращает все объекты бакета с указанным префиксом
+func ListObjects(ctx context.Context, bucketName, prefix string) ([]ObjectInfo, error) {
+	minioClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	for object := range minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("list objects failed: %v", object.Err)
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+			StorageClass: object.StorageClass,
+		})
+	}
+	return objects, nil
+}
+
+// DownloadObject скачивает объект по полному ключу в локальный файл.
+// Для объектов, зашифрованных SSE-C, передается тот же ключ sse, что и при загрузке.
+func DownloadObject(ctx context.Context, bucketName, key, filePath string, sse encrypt.ServerSide) error {
+	minioClient, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := minioClient.FGetObject(ctx, bucketName, key, filePath, minio.GetObjectOptions{ServerSideEncryption: sse}); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		}
+		return fmt.Errorf("object download failed: %v", err)
+	}
+	return nil
+}
+
+// OpenObject открывает объект по полному ключу для чтения потоком
+func OpenObject(ctx context.Context, bucketName, key string) (io.ReadCloser, error) {
+	minioClient, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := minioClient.GetObject(ctx, bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("object download failed: %v", err)
+	}
+	// GetObject не обращается к серверу до первого чтения, поэтому отсутствие объекта проверяется здесь
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		}
+		return nil, fmt.Errorf("object download failed: %v", err)
+	}
+	return object, nil
+}
+
+// StatObject возвращает сведения об объекте и его пользовательские метаданные
+func StatObject(ctx context.Context, bucketName, key string, sse encrypt.ServerSide) (ObjectInfo, error) {
+	minioClient, err := newClient()
+	if err != nil {
+		return ObjectInfo{}, err
 	}
 
-	ctx := context.Background()
+	object, err := minioClient.StatObject(ctx, bucketName, key, minio.StatObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return ObjectInfo{}, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		}
+		return ObjectInfo{}, fmt.Errorf("object stat failed: %v", err)
+	}
+	return ObjectInfo{
+		Key:          object.Key,
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		StorageClass: object.StorageClass,
+		Metadata:     object.UserMetadata,
+	}, nil
+}
+
+// RemoveObjects удаляет объекты по полным ключам
+func RemoveObjects(ctx context.Context, bucketName string, keys []string) error {
+	minioClient, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	objects := make(chan minio.ObjectInfo, len(keys))
+	for _, key := range keys {
+		objects <- minio.ObjectInfo{Key: key}
+	}
+	close(objects)
+
+	for result := range minioClient.RemoveObjects(ctx, bucketName, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("remove object %s failed: %v", result.ObjectName, result.Err)
+		}
+	}
+	return nil
+}
+
+// BucketExists проверяет доступность MinIO и наличие бакета
+func BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	minioClient, err := newClient()
+	if err != nil {
+		return false, err
+	}
+	exists, err := minioClient.BucketExists(ctx, bucketName)
+	if err != nil {
+		return false, fmt.Errorf("bucket check failed: %v", err)
+	}
+	return exists, nil
+}
+
+// UploadToMinio загружает файл в MinIO с учетом структуры проекта
+func UploadToMinio(ctx context.Context, params UploadParams) error {
+	// Валидация параметров
+	if params.Project == "" || params.BucketName == "" || params.ObjectPath == "" || (params.FilePath == "" && params.Reader == nil) {
+		return fmt.Errorf("all upload parameters must be specified")
+	}
+
+	minioClient, err := newClient()
+	if err != nil {
+		return err
+	}
 
 	// Проверка и создание бакета при необходимости
 	exists, err := minioClient.BucketExists(ctx, params.BucketName)
@@ -62,27 +238,69 @@ func UploadToMinio(params UploadParams) error {
 	// Нормализация путей для MinIO
 	fullObjectPath = strings.ReplaceAll(fullObjectPath, string(filepath.Separator), "/")
 
-	// Загрузка файла
-	_, err = minioClient.FPutObject(
+	// Поток загружается multipart-частями; ошибка чтения до EOF отменяет загрузку целиком
+	reader, size := params.Reader, int64(-1)
+	if params.Size > 0 {
+		size = params.Size
+	}
+	if reader == nil {
+		file, err := os.Open(params.FilePath)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %v", err)
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %v", err)
+		}
+		reader, size = file, stat.Size()
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(params.ObjectPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	metadata := map[string]string{
+		"x-amz-acl": "private",
+		"Project":   params.Project,
+	}
+	for key, value := range params.Metadata {
+		metadata[key] = value
+	}
+
+	// Загрузка файла; ограничение скорости применяется к потоку, который читает клиент MinIO
+	info, err := minioClient.PutObject(
 		ctx,
 		params.BucketName,
 		fullObjectPath,
-		params.FilePath,
+		throttle.Reader(ctx, reader, params.Throttle...),
+		size,
 		minio.PutObjectOptions{
-			UserMetadata: map[string]string{
-				"x-amz-acl": "private",
-				"Project":   params.Project,
-			},
+			ContentType:          contentType,
+			UserMetadata:         metadata,
+			ServerSideEncryption: params.Encryption,
 		},
 	)
 	if err != nil {
+		// Удаляем незавершенную multipart-загрузку; исходный контекст может быть уже отменен
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if rmErr := minioClient.RemoveIncompleteUpload(cleanupCtx, params.BucketName, fullObjectPath); rmErr != nil {
+			logging.FromContext(ctx).Warn("failed to remove incomplete upload", "object", fullObjectPath, "error", rmErr)
+		}
 		return fmt.Errorf("file upload failed: %v", err)
 	}
 
-	fmt.Printf("Successfully uploaded %s to %s/%s\n",
-		params.FilePath,
-		params.BucketName,
-		fullObjectPath,
+	logger := logging.FromContext(ctx)
+	if params.FilePath != "" {
+		logger = logger.With("file", params.FilePath)
+	}
+	logger.Info("upload completed",
+		"size", info.Size,
+		"bucket", params.BucketName,
+		"object", fullObjectPath,
 	)
 
 	return nil
@@ -0,0 +1,340 @@
+package minio
+
+import (
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/throttle"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// maxCopySize - наибольший объект, который S3 копирует одним запросом; большие копируются по частям
+const maxCopySize = 5 << 30
+
+// Метаданные зеркальной копии объекта
+const (
+	mirrorETagKey      = "Mirror-Source-Etag" // ETag объекта в источнике на момент копирования
+	mirrorDeletedAtKey = "Mirror-Deleted-At"  // Время, когда объект пропал из источника (RFC 3339)
+)
+
+// S3Endpoint описывает сервер S3, отличный от MinIO из окружения
+type S3Endpoint struct {
+	URL       string // Адрес со схемой (https://s3.example.com)
+	AccessKey string
+	SecretKey string
+	Region    string
+}
+
+// MirrorParams содержит параметры зеркалирования бакета
+type MirrorParams struct {
+	Source       *S3Endpoint   // Сервер источника (nil - тот же MinIO, копирование на стороне сервера)
+	SourceBucket string        // Бакет источника
+	SourcePrefix string        // Префикс объектов в источнике
+	BucketName   string        // Бакет назначения
+	Prefix       string        // Префикс копий в бакете назначения (с завершающим /)
+	KeepDeleted  time.Duration // Сколько хранить копии удаленных из источника объектов (0 - удалять при первом же запуске)
+
+	Throttle []*throttle.Limiter // Ограничители скорости копирования через клиент
+}
+
+// MirrorStats содержит итоги зеркалирования
+type MirrorStats struct {
+	Copied  int   // Скопировано новых и измененных объектов
+	Skipped int   // Пропущено неизмененных объектов
+	Bytes   int64 // Объем скопированных данных
+	Marked  int   // Помечено удаленными в источнике
+	Removed int   // Удалено копий после истечения срока хранения
+}
+
+// mirrorObject описывает объект в листинге источника или назначения
+type mirrorObject struct {
+	Key      string
+	ETag     string
+	Size     int64
+	Metadata map[string]string // Пользовательские метаданные без префикса x-amz-meta- (если их вернул листинг)
+}
+
+// Mirror копирует в префикс назначения новые и измененные объекты источника.
+// Изменения определяются по размеру и ETag источника, сохраненному в метаданных копии.
+// Копии объектов, удаленных из источника, помечаются и удаляются через KeepDeleted.
+func Mirror(ctx context.Context, params MirrorParams) (MirrorStats, error) {
+	var stats MirrorStats
+
+	dstClient, err := newClient()
+	if err != nil {
+		return stats, err
+	}
+	srcClient := dstClient
+	if params.Source != nil {
+		if srcClient, err = newEndpointClient(*params.Source); err != nil {
+			return stats, err
+		}
+	}
+
+	exists, err := dstClient.BucketExists(ctx, params.BucketName)
+	if err != nil {
+		return stats, fmt.Errorf("bucket check failed: %v", err)
+	}
+	if !exists {
+		if err := dstClient.MakeBucket(ctx, params.BucketName, minio.MakeBucketOptions{}); err != nil {
+			return stats, fmt.Errorf("bucket creation failed: %v", err)
+		}
+	}
+
+	sources, err := listMirrorObjects(ctx, srcClient, params.SourceBucket, params.SourcePrefix, false)
+	if err != nil {
+		return stats, fmt.Errorf("source: %w", err)
+	}
+	copies, err := listMirrorObjects(ctx, dstClient, params.BucketName, params.Prefix, true)
+	if err != nil {
+		return stats, fmt.Errorf("destination: %w", err)
+	}
+	// Пустой источник при непустой копии скорее означает ошибку в настройках, чем удаление всех данных
+	if len(sources) == 0 && len(copies) > 0 {
+		return stats, fmt.Errorf("source %s/%s is empty, refusing to mark %d objects as deleted", params.SourceBucket, params.SourcePrefix, len(copies))
+	}
+
+	logger := logging.FromContext(ctx)
+	for name, source := range sources {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		dstKey := params.Prefix + name
+		if replica, ok := copies[name]; ok {
+			metadata, err := mirrorMetadata(ctx, dstClient, params.BucketName, replica)
+			if err != nil {
+				return stats, err
+			}
+			if replica.Size == source.Size && metadata[mirrorETagKey] == source.ETag && metadata[mirrorDeletedAtKey] == "" {
+				stats.Skipped++
+				continue
+			}
+		}
+
+		copied, err := mirrorCopy(ctx, srcClient, dstClient, params, source, dstKey)
+		if err != nil {
+			return stats, fmt.Errorf("copy %s: %w", source.Key, err)
+		}
+		if !copied {
+			logger.Warn("object changed during mirroring, will retry on the next run", "object", source.Key)
+			continue
+		}
+		stats.Copied++
+		stats.Bytes += source.Size
+	}
+
+	// Копии объектов, которых больше нет в источнике
+	now := time.Now().UTC()
+	var expired []string
+	for name, replica := range copies {
+		if _, ok := sources[name]; ok {
+			continue
+		}
+		if params.KeepDeleted == 0 {
+			expired = append(expired, replica.Key)
+			continue
+		}
+
+		metadata, err := mirrorMetadata(ctx, dstClient, params.BucketName, replica)
+		if err != nil {
+			return stats, err
+		}
+		deletedAt, err := time.Parse(time.RFC3339, metadata[mirrorDeletedAtKey])
+		if err != nil {
+			if err := markDeleted(ctx, dstClient, params.BucketName, replica.Key, now); err != nil {
+				return stats, fmt.Errorf("mark %s deleted: %w", replica.Key, err)
+			}
+			stats.Marked++
+			continue
+		}
+		if now.Sub(deletedAt) > params.KeepDeleted {
+			expired = append(expired, replica.Key)
+		}
+	}
+	if len(expired) > 0 {
+		if err := RemoveObjects(ctx, params.BucketName, expired); err != nil {
+			return stats, err
+		}
+		stats.Removed = len(expired)
+	}
+
+	return stats, nil
+}
+
+// newEndpointClient создает клиент для стороннего сервера S3
+func newEndpointClient(endpoint S3Endpoint) (*minio.Client, error) {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", endpoint.URL)
+	}
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(endpoint.AccessKey, endpoint.SecretKey, ""),
+		Secure: u.Scheme == "https",
+		Region: endpoint.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("S3 client initialization failed: %v", err)
+	}
+	return client, nil
+}
+
+// listMirrorObjects возвращает объекты с префиксом, индексированные по ключу без префикса.
+// Маркеры каталогов (ключи, оканчивающиеся на /) пропускаются.
+func listMirrorObjects(ctx context.Context, client *minio.Client, bucketName, prefix string, withMetadata bool) (map[string]mirrorObject, error) {
+	objects := make(map[string]mirrorObject)
+	for object := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+		// Расширение MinIO: метаданные в листинге избавляют от запроса на каждый объект
+		WithMetadata: withMetadata,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("list objects failed: %v", object.Err)
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		var metadata map[string]string
+		if object.UserMetadata != nil {
+			metadata = make(map[string]string, len(object.UserMetadata))
+			for key, value := range object.UserMetadata {
+				key = http.CanonicalHeaderKey(key)
+				if name, ok := strings.CutPrefix(key, "X-Amz-Meta-"); ok {
+					metadata[name] = value
+				}
+			}
+		}
+		objects[strings.TrimPrefix(object.Key, prefix)] = mirrorObject{
+			Key:      object.Key,
+			ETag:     object.ETag,
+			Size:     object.Size,
+			Metadata: metadata,
+		}
+	}
+	return objects, nil
+}
+
+// mirrorMetadata возвращает метаданные копии, запрашивая их, если листинг их не вернул
+func mirrorMetadata(ctx context.Context, client *minio.Client, bucketName string, object mirrorObject) (map[string]string, error) {
+	if object.Metadata[mirrorETagKey] != "" {
+		return object.Metadata, nil
+	}
+	info, err := client.StatObject(ctx, bucketName, object.Key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("object stat failed: %v", err)
+	}
+	return info.UserMetadata, nil
+}
+
+// mirrorCopy копирует объект источника в dstKey с сохранением типа и метаданных.
+// На том же сервере копирование выполняется на стороне сервера, иначе поток идет через клиент.
+// Возвращает false, если объект изменился в источнике во время копирования.
+func mirrorCopy(ctx context.Context, srcClient, dstClient *minio.Client, params MirrorParams, source mirrorObject, dstKey string) (bool, error) {
+	info, err := srcClient.StatObject(ctx, params.SourceBucket, source.Key, minio.StatObjectOptions{})
+	if err != nil {
+		return false, fmt.Errorf("object stat failed: %v", err)
+	}
+	if info.ETag != source.ETag {
+		return false, nil
+	}
+
+	metadata := make(map[string]string, len(info.UserMetadata)+1)
+	for key, value := range info.UserMetadata {
+		metadata[key] = value
+	}
+	metadata[mirrorETagKey] = source.ETag
+
+	if params.Source == nil {
+		metadata["Content-Type"] = info.ContentType
+		err := serverSideCopy(ctx, dstClient, info.Size, minio.CopyDestOptions{
+			Bucket:          params.BucketName,
+			Object:          dstKey,
+			UserMetadata:    metadata,
+			ReplaceMetadata: true,
+		}, minio.CopySrcOptions{
+			Bucket:    params.SourceBucket,
+			Object:    source.Key,
+			MatchETag: source.ETag,
+		})
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("server-side copy failed: %v", err)
+		}
+		return true, nil
+	}
+
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetMatchETag(source.ETag); err != nil {
+		return false, err
+	}
+	object, err := srcClient.GetObject(ctx, params.SourceBucket, source.Key, opts)
+	if err != nil {
+		return false, fmt.Errorf("object download failed: %v", err)
+	}
+	defer object.Close()
+
+	_, err = dstClient.PutObject(ctx, params.BucketName, dstKey, throttle.Reader(ctx, object, params.Throttle...), info.Size, minio.PutObjectOptions{
+		ContentType:  info.ContentType,
+		UserMetadata: metadata,
+	})
+	if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+		return false, nil
+	}
+	if err != nil {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		if rmErr := dstClient.RemoveIncompleteUpload(cleanupCtx, params.BucketName, dstKey); rmErr != nil {
+			logging.FromContext(ctx).Warn("failed to remove incomplete upload", "object", dstKey, "error", rmErr)
+		}
+		return false, fmt.Errorf("object upload failed: %v", err)
+	}
+	return true, nil
+}
+
+// markDeleted добавляет копии отметку об удалении из источника, копируя объект в себя с новыми метаданными
+func markDeleted(ctx context.Context, client *minio.Client, bucketName, key string, deletedAt time.Time) error {
+	info, err := client.StatObject(ctx, bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("object stat failed: %v", err)
+	}
+
+	metadata := make(map[string]string, len(info.UserMetadata)+2)
+	for key, value := range info.UserMetadata {
+		metadata[key] = value
+	}
+	metadata["Content-Type"] = info.ContentType
+	metadata[mirrorDeletedAtKey] = deletedAt.Format(time.RFC3339)
+
+	err = serverSideCopy(ctx, client, info.Size, minio.CopyDestOptions{
+		Bucket:          bucketName,
+		Object:          key,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+	}, minio.CopySrcOptions{
+		Bucket: bucketName,
+		Object: key,
+	})
+	if err != nil {
+		return fmt.Errorf("metadata update failed: %v", err)
+	}
+	return nil
+}
+
+// serverSideCopy копирует объект на стороне сервера одним запросом или, для больших объектов, по частям
+func serverSideCopy(ctx context.Context, client *minio.Client, size int64, dst minio.CopyDestOptions, src minio.CopySrcOptions) error {
+	if size <= maxCopySize {
+		_, err := client.CopyObject(ctx, dst, src)
+		return err
+	}
+	_, err := client.ComposeObject(ctx, dst, src)
+	return err
+}
@@ -0,0 +1,523 @@
+package minio
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3Object - объект в заглушке S3
+type s3Object struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string // Пользовательские метаданные без префикса X-Amz-Meta-
+	modified    time.Time
+}
+
+func (o *s3Object) etag() string {
+	sum := md5.Sum(o.data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Stub - заглушка S3 с запросами, которые выполняет зеркалирование
+type s3Stub struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]*s3Object
+	copies  int // Копирований на стороне сервера (включая смену метаданных)
+	puts    int // Загрузок с телом объекта
+}
+
+func newS3Stub(t *testing.T) (*s3Stub, string) {
+	t.Helper()
+	stub := &s3Stub{buckets: make(map[string]map[string]*s3Object)}
+	server := httptest.NewServer(http.HandlerFunc(stub.serveHTTP))
+	t.Cleanup(server.Close)
+	return stub, server.URL
+}
+
+// useS3Stub направляет клиент MinIO из окружения на заглушку
+func useS3Stub(t *testing.T, serverURL string) {
+	t.Setenv("MINIO_ENDPOINT", strings.TrimPrefix(serverURL, "http://"))
+	t.Setenv("MINIO_ACCESS_KEY", "minio-access")
+	t.Setenv("MINIO_SECRET_KEY", "minio-secret")
+	t.Setenv("MINIO_USE_SSL", "false")
+}
+
+// put создает или заменяет объект
+func (s *s3Stub) put(bucket, key, data string, metadata map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = make(map[string]*s3Object)
+	}
+	s.buckets[bucket][key] = &s3Object{data: []byte(data), contentType: "text/plain", metadata: metadata, modified: time.Now()}
+}
+
+// get возвращает объект или nil
+func (s *s3Stub) get(bucket, key string) *s3Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buckets[bucket][key]
+}
+
+// keys возвращает отсортированные ключи бакета
+func (s *s3Stub) keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *s3Stub) counters() (copies, puts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.copies, s.puts
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func (s *s3Stub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	if query.Has("location") {
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+		}{})
+		return
+	}
+
+	bucket, exists := s.buckets[bucketName]
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead && exists:
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			if !exists {
+				s.buckets[bucketName] = make(map[string]*s3Object)
+			}
+		case r.Method == http.MethodGet && query.Get("list-type") == "2":
+			s.list(w, bucketName, bucket, query.Get("prefix"))
+		case r.Method == http.MethodPost && query.Has("delete"):
+			s.remove(w, r, bucket)
+		default:
+			s3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	if !exists {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		object, ok := bucket[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				s3Error(w, http.StatusNotFound, "NoSuchKey")
+			}
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && strings.Trim(match, `"`) != object.etag() {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		header := w.Header()
+		header.Set("ETag", `"`+object.etag()+`"`)
+		header.Set("Content-Type", object.contentType)
+		header.Set("Content-Length", strconv.Itoa(len(object.data)))
+		header.Set("Last-Modified", object.modified.UTC().Format(http.TimeFormat))
+		for name, value := range object.metadata {
+			header.Set("X-Amz-Meta-"+name, value)
+		}
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			s.copy(w, r, bucket, key, source)
+			return
+		}
+		data, err := readPayload(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		object := &s3Object{data: data, contentType: r.Header.Get("Content-Type"), metadata: userMetadata(r.Header), modified: time.Now()}
+		bucket[key] = object
+		s.puts++
+		w.Header().Set("ETag", `"`+object.etag()+`"`)
+
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list отвечает на ListObjectsV2 без разбиения на страницы
+func (s *s3Stub) list(w http.ResponseWriter, bucketName string, bucket map[string]*s3Object, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucketName, Prefix: prefix, MaxKeys: 1000}
+	for key, object := range bucket {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + object.etag() + `"`,
+			Size:         len(object.data),
+		})
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	writeXML(w, result)
+}
+
+// remove отвечает на DeleteObjects
+func (s *s3Stub) remove(w http.ResponseWriter, r *http.Request, bucket map[string]*s3Object) {
+	var request struct {
+		Objects []struct{ Key string } `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		s3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	type deleted struct{ Key string }
+	result := struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []deleted
+	}{}
+	for _, object := range request.Objects {
+		delete(bucket, object.Key)
+		result.Deleted = append(result.Deleted, deleted{Key: object.Key})
+	}
+	writeXML(w, result)
+}
+
+// copy отвечает на CopyObject внутри заглушки
+func (s *s3Stub) copy(w http.ResponseWriter, r *http.Request, bucket map[string]*s3Object, key, source string) {
+	source, _ = url.PathUnescape(source)
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	object, ok := s.buckets[srcBucket][srcKey]
+	if !ok {
+		s3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	if match := r.Header.Get("X-Amz-Copy-Source-If-Match"); match != "" && strings.Trim(match, `"`) != object.etag() {
+		s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	}
+
+	replica := &s3Object{data: object.data, contentType: object.contentType, metadata: object.metadata, modified: time.Now()}
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		replica.contentType = r.Header.Get("Content-Type")
+		replica.metadata = userMetadata(r.Header)
+	}
+	bucket[key] = replica
+	s.copies++
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: `"` + replica.etag() + `"`, LastModified: replica.modified.UTC().Format("2006-01-02T15:04:05.000Z")})
+}
+
+// userMetadata извлекает пользовательские метаданные из заголовков
+func userMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for name := range header {
+		if key, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok {
+			metadata[key] = header.Get(name)
+		}
+	}
+	return metadata
+}
+
+// readPayload читает тело загрузки; при подписи по частям (aws-chunked) удаляет разметку частей
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2) // Часть и завершающий \r\n
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+func TestMirrorServerSide(t *testing.T) {
+	stub, serverURL := newS3Stub(t)
+	useS3Stub(t, serverURL)
+	stub.put("uploads", "users/avatar.png", "avatar", map[string]string{"Owner": "42"})
+	stub.put("uploads", "users/docs/cv.pdf", "cv", nil)
+	stub.put("uploads", "other/ignored.txt", "outside the prefix", nil)
+
+	params := MirrorParams{
+		SourceBucket: "uploads",
+		SourcePrefix: "users/",
+		BucketName:   "backups",
+		Prefix:       "prod/uploads/",
+		KeepDeleted:  time.Hour,
+	}
+	ctx := context.Background()
+	stats, err := Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 2 || stats.Bytes != int64(len("avatar")+len("cv")) {
+		t.Errorf("first run: %+v", stats)
+	}
+	if got := strings.Join(stub.keys("backups"), ","); got != "prod/uploads/avatar.png,prod/uploads/docs/cv.pdf" {
+		t.Errorf("mirrored keys = %s", got)
+	}
+	// Тот же сервер: только копирование на стороне сервера
+	if copies, puts := stub.counters(); copies != 2 || puts != 0 {
+		t.Errorf("copies = %d, uploads = %d", copies, puts)
+	}
+
+	replica := stub.get("backups", "prod/uploads/avatar.png")
+	source := stub.get("uploads", "users/avatar.png")
+	if string(replica.data) != "avatar" || replica.contentType != "text/plain" {
+		t.Errorf("replica: %q (%s)", replica.data, replica.contentType)
+	}
+	if replica.metadata["Owner"] != "42" || replica.metadata[mirrorETagKey] != source.etag() {
+		t.Errorf("replica metadata: %v", replica.metadata)
+	}
+
+	// Неизмененные объекты пропускаются, измененный копируется заново
+	stub.put("uploads", "users/docs/cv.pdf", "cv, second edition", nil)
+	stats, err = Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 1 || stats.Skipped != 1 {
+		t.Errorf("second run: %+v", stats)
+	}
+	if replica := stub.get("backups", "prod/uploads/docs/cv.pdf"); string(replica.data) != "cv, second edition" {
+		t.Errorf("changed object not copied: %q", replica.data)
+	}
+
+	stats, err = Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 0 || stats.Skipped != 2 {
+		t.Errorf("third run: %+v", stats)
+	}
+}
+
+func TestMirrorStreamed(t *testing.T) {
+	srcStub, srcURL := newS3Stub(t)
+	dstStub, dstURL := newS3Stub(t)
+	useS3Stub(t, dstURL)
+	srcStub.put("uploads", "users/avatar.png", strings.Repeat("pixel", 1000), map[string]string{"Owner": "42"})
+
+	params := MirrorParams{
+		Source:       &S3Endpoint{URL: srcURL, AccessKey: "src-access", SecretKey: "src-secret"},
+		SourceBucket: "uploads",
+		SourcePrefix: "users/",
+		BucketName:   "backups",
+		Prefix:       "prod/uploads/",
+	}
+	stats, err := Mirror(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 1 || stats.Bytes != 5000 {
+		t.Errorf("stats: %+v", stats)
+	}
+	// Другой сервер: данные проходят через клиент
+	if copies, puts := dstStub.counters(); copies != 0 || puts != 1 {
+		t.Errorf("copies = %d, uploads = %d", copies, puts)
+	}
+
+	replica := dstStub.get("backups", "prod/uploads/avatar.png")
+	source := srcStub.get("uploads", "users/avatar.png")
+	if replica == nil || string(replica.data) != string(source.data) {
+		t.Fatal("replica data does not match the source")
+	}
+	if replica.contentType != "text/plain" || replica.metadata["Owner"] != "42" || replica.metadata[mirrorETagKey] != source.etag() {
+		t.Errorf("replica: %s %v", replica.contentType, replica.metadata)
+	}
+
+	stats, err = Mirror(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Skipped != 1 || stats.Copied != 0 {
+		t.Errorf("second run: %+v", stats)
+	}
+}
+
+func TestMirrorKeepDeleted(t *testing.T) {
+	stub, serverURL := newS3Stub(t)
+	useS3Stub(t, serverURL)
+	stub.put("uploads", "users/a.txt", "a", nil)
+	stub.put("uploads", "users/b.txt", "b", nil)
+
+	params := MirrorParams{
+		SourceBucket: "uploads",
+		SourcePrefix: "users/",
+		BucketName:   "backups",
+		Prefix:       "mirror/",
+		KeepDeleted:  24 * time.Hour,
+	}
+	ctx := context.Background()
+	if _, err := Mirror(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+
+	// Удаленный из источника объект сначала только помечается
+	stub.mu.Lock()
+	delete(stub.buckets["uploads"], "users/b.txt")
+	stub.mu.Unlock()
+	stats, err := Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Marked != 1 || stats.Removed != 0 {
+		t.Errorf("after deletion: %+v", stats)
+	}
+	replica := stub.get("backups", "mirror/b.txt")
+	if replica == nil || string(replica.data) != "b" {
+		t.Fatal("copy of the deleted object is gone")
+	}
+	deletedAt, err := time.Parse(time.RFC3339, replica.metadata[mirrorDeletedAtKey])
+	if err != nil || time.Since(deletedAt) > time.Minute {
+		t.Fatalf("deletion mark: %v", replica.metadata)
+	}
+
+	// До истечения keep-deleted копия остается
+	stats, err = Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Marked != 0 || stats.Removed != 0 || stub.get("backups", "mirror/b.txt") == nil {
+		t.Errorf("within keep-deleted: %+v", stats)
+	}
+
+	// Вернувшийся в источник объект копируется заново, отметка снимается
+	stub.put("uploads", "users/b.txt", "b", nil)
+	stats, err = Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 1 || stub.get("backups", "mirror/b.txt").metadata[mirrorDeletedAtKey] != "" {
+		t.Errorf("restored object: %+v, %v", stats, stub.get("backups", "mirror/b.txt").metadata)
+	}
+
+	// После keep-deleted копия удаляется
+	stub.mu.Lock()
+	delete(stub.buckets["uploads"], "users/b.txt")
+	stub.mu.Unlock()
+	if _, err := Mirror(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	stub.buckets["backups"]["mirror/b.txt"].metadata[mirrorDeletedAtKey] = time.Now().Add(-25 * time.Hour).UTC().Format(time.RFC3339)
+	stub.mu.Unlock()
+	stats, err = Mirror(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 1 {
+		t.Errorf("after keep-deleted: %+v", stats)
+	}
+	if got := strings.Join(stub.keys("backups"), ","); got != "mirror/a.txt" {
+		t.Errorf("mirrored keys = %s", got)
+	}
+}
+
+func TestMirrorEmptySource(t *testing.T) {
+	stub, serverURL := newS3Stub(t)
+	useS3Stub(t, serverURL)
+	stub.put("uploads", "users/a.txt", "a", nil)
+
+	params := MirrorParams{
+		SourceBucket: "uploads",
+		SourcePrefix: "users/",
+		BucketName:   "backups",
+		Prefix:       "mirror/",
+	}
+	ctx := context.Background()
+	if _, err := Mirror(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+
+	// Опечатка в префиксе не должна стереть копию, даже без keep-deleted
+	params.SourcePrefix = "user/"
+	stats, err := Mirror(ctx, params)
+	if err == nil || !strings.Contains(err.Error(), "refusing to mark 1 objects as deleted") {
+		t.Fatalf("expected empty source error, got %v", err)
+	}
+	if stats.Marked != 0 || stats.Removed != 0 {
+		t.Errorf("stats: %+v", stats)
+	}
+	replica := stub.get("backups", "mirror/a.txt")
+	if replica == nil || replica.metadata[mirrorDeletedAtKey] != "" {
+		t.Error("copy was removed or marked deleted")
+	}
+}
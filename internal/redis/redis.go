@@ -0,0 +1,391 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eofMarkLen - длина маркера конца RDB при бездисковой репликации ($EOF:<mark>)
+const eofMarkLen = 40
+
+// Options содержит параметры подключения к Redis
+type Options struct {
+	Addr     string // Адрес в формате host:port
+	Username string // Пользователь ACL (Redis 6+)
+	Password string
+	DB       int
+	TLS      *tls.Config // nil - без TLS
+}
+
+// ParseURL разбирает строку подключения вида redis://[user:pass@]host:port/db или rediss://... (TLS).
+// caFile задает сертификат CA для проверки сервера (пусто - системные сертификаты).
+func ParseURL(rawURL, caFile string) (*Options, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	opts := &Options{}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		opts.TLS = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile)
+			}
+			opts.TLS.RootCAs = pool
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Redis URL scheme: %s", u.Scheme)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return nil, fmt.Errorf("Redis URL has no host")
+	}
+	if port == "" {
+		port = "6379"
+	}
+	opts.Addr = net.JoinHostPort(host, port)
+
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+		// redis://:password@host - только пароль без пользователя
+		if opts.Password == "" && opts.Username != "" && !strings.Contains(u.User.String(), ":") {
+			opts.Password, opts.Username = opts.Username, ""
+		}
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opts.DB, err = strconv.Atoi(db); err != nil || opts.DB < 0 {
+			return nil, fmt.Errorf("invalid Redis database number: %s", db)
+		}
+	}
+	return opts, nil
+}
+
+// Error - ответ Redis с ошибкой
+type Error string
+
+// Error возвращает текст ошибки Redis
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Conn - минимальный клиент протокола RESP2: команды, нужные для резервного копирования
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	stop func() bool // Отменяет прерывание соединения по контексту
+}
+
+// Dial подключается к Redis, выполняет AUTH и SELECT
+func Dial(ctx context.Context, opts *Options) (*Conn, error) {
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	if opts.TLS != nil {
+		tlsConn := tls.Client(netConn, opts.TLS)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		netConn = tlsConn
+	}
+
+	// Отмена контекста прерывает блокирующие чтения и записи
+	c := &Conn{conn: netConn, r: bufio.NewReader(netConn)}
+	c.stop = context.AfterFunc(ctx, func() { netConn.SetDeadline(time.Now()) })
+
+	if opts.Password != "" {
+		args := []string{"AUTH", opts.Password}
+		if opts.Username != "" {
+			args = []string{"AUTH", opts.Username, opts.Password}
+		}
+		if _, err := c.Do(args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if opts.DB != 0 {
+		if _, err := c.Do("SELECT", strconv.Itoa(opts.DB)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("select failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Close закрывает соединение
+func (c *Conn) Close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// Do отправляет команду и возвращает ответ: string, int64, []any или nil.
+// Ответ-ошибка возвращается как Error.
+func (c *Conn) Do(args ...string) (any, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// send записывает команду в формате массива bulk-строк
+func (c *Conn) send(args ...string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+// readLine читает строку ответа без завершающего CRLF
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// readReply читает один ответ RESP2
+func (c *Conn) readReply() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := c.readReply()
+			if err != nil {
+				var redisErr Error
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				item = redisErr
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply: %q", line)
+	}
+}
+
+// Info возвращает поля раздела INFO в виде словаря
+func (c *Conn) Info(section string) (map[string]string, error) {
+	reply, err := c.Do("INFO", section)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected INFO reply")
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = value
+		}
+	}
+	return fields, nil
+}
+
+// BGSave запускает фоновое сохранение и ждет его завершения, опрашивая INFO persistence.
+// Если сохранение уже выполняется, ждет его завершения и запускает новое.
+func (c *Conn) BGSave(ctx context.Context, pollInterval time.Duration) error {
+	lastSave, err := c.Do("LASTSAVE")
+	if err != nil {
+		return fmt.Errorf("LASTSAVE failed: %w", err)
+	}
+
+	for {
+		_, err := c.Do("BGSAVE")
+		if err == nil {
+			break
+		}
+		// Идет сохранение или перезапись AOF - ждем и повторяем
+		var redisErr Error
+		if !errors.As(err, &redisErr) || !strings.Contains(strings.ToLower(string(redisErr)), "in progress") {
+			return fmt.Errorf("BGSAVE failed: %w", err)
+		}
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if err := sleep(ctx, pollInterval); err != nil {
+			return err
+		}
+		info, err := c.Info("persistence")
+		if err != nil {
+			return fmt.Errorf("INFO failed: %w", err)
+		}
+		if info["rdb_bgsave_in_progress"] != "0" {
+			continue
+		}
+		current, err := c.Do("LASTSAVE")
+		if err != nil {
+			return fmt.Errorf("LASTSAVE failed: %w", err)
+		}
+		if current == lastSave {
+			continue
+		}
+		if status := info["rdb_last_bgsave_status"]; status != "ok" {
+			return fmt.Errorf("BGSAVE finished with status %q", status)
+		}
+		return nil
+	}
+}
+
+// SyncRDB запрашивает у сервера снимок по протоколу репликации (как redis-cli --rdb)
+// и записывает RDB в w. Сервер сам создает новый снимок для передачи.
+func (c *Conn) SyncRDB(w io.Writer) (int64, error) {
+	// Redis 7+ не будет передавать поток команд после снимка; старые версии вернут ошибку
+	_, _ = c.Do("REPLCONF", "rdb-only", "1")
+
+	if err := c.send("SYNC"); err != nil {
+		return 0, err
+	}
+
+	// Пока снимок готовится, сервер отправляет пустые строки для поддержания соединения
+	var line string
+	for {
+		var err error
+		if line, err = c.readLine(); err != nil {
+			return 0, err
+		}
+		if line != "" {
+			break
+		}
+	}
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return 0, Error(line[1:])
+	case !strings.HasPrefix(line, "$"):
+		return 0, fmt.Errorf("unexpected SYNC reply: %q", line)
+	}
+
+	// Бездисковая репликация: длина неизвестна, поток завершается маркером
+	if mark, ok := strings.CutPrefix(line, "$EOF:"); ok {
+		if len(mark) != eofMarkLen {
+			return 0, fmt.Errorf("invalid EOF mark")
+		}
+		return copyUntilMark(w, c.r, []byte(mark))
+	}
+
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid RDB size: %w", err)
+	}
+	n, err := io.CopyN(w, c.r, size)
+	if err != nil {
+		return n, fmt.Errorf("RDB transfer interrupted: %w", err)
+	}
+	return n, nil
+}
+
+// copyUntilMark копирует поток в w до маркера конца, не записывая сам маркер
+func copyUntilMark(w io.Writer, r io.Reader, mark []byte) (int64, error) {
+	buf := make([]byte, 64<<10)
+	// Последние len(mark) байт удерживаются, пока не станет ясно, что это не маркер
+	var pending []byte
+	var written int64
+	for {
+		n, err := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if bytes.HasSuffix(pending, mark) {
+			m, werr := w.Write(pending[:len(pending)-len(mark)])
+			return written + int64(m), werr
+		}
+		if len(pending) > len(mark) {
+			flush := len(pending) - len(mark)
+			m, werr := w.Write(pending[:flush])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			pending = append(pending[:0], pending[flush:]...)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return written, fmt.Errorf("RDB transfer interrupted: %w", err)
+		}
+	}
+}
+
+// sleep ждет указанное время или отмены контекста
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
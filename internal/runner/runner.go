@@ -0,0 +1,459 @@
+package runner
+
+import (
+	"backup-to-minio/internal/backup"
+	"backup-to-minio/internal/config"
+	"backup-to-minio/internal/logging"
+	"backup-to-minio/internal/throttle"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrSkipped возвращается, если запуск пропущен из-за выполняющегося предыдущего запуска
+var ErrSkipped = errors.New("previous run is still in progress")
+
+// ErrNotRunning возвращается при попытке отменить завершенный запуск
+var ErrNotRunning = errors.New("run is not in progress")
+
+// ErrClosed возвращается при попытке запуска после начала остановки (Wait)
+var ErrClosed = errors.New("runner is shutting down")
+
+// Статусы запуска
+const (
+	StatusRunning   = "running"
+	StatusSuccess   = "success"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	StatusCancelled = "cancelled"
+)
+
+// Источники запуска
+const (
+	TriggerImmediate = "immediate"
+	TriggerSchedule  = "schedule"
+	TriggerManual    = "manual"
+	TriggerAPI       = "api"
+)
+
+// maxRuns - количество последних запусков, хранимых в памяти
+const maxRuns = 200
+
+// maxRunLog - максимальный размер лога одного запуска в памяти
+const maxRunLog = 1 << 20
+
+// RunInfo описывает состояние запуска резервного копирования
+type RunInfo struct {
+	ID         string    `json:"id"`
+	Backup     string    `json:"backup"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	Log        string    `json:"log,omitempty"`
+}
+
+// run хранит состояние одного запуска
+type run struct {
+	info   RunInfo
+	log    limitedBuffer
+	cancel context.CancelFunc
+}
+
+// jobState хранит состояние отдельного задания
+type jobState struct {
+	lock    chan struct{} // Занят, пока выполняется запуск задания
+	skipped int           // Количество пропущенных запусков
+	lastRun *run          // Последний запуск задания
+	success time.Time     // Время завершения последнего успешного запуска
+}
+
+// Runner запускает резервные копии с учетом политики пересечений и лимитов параллельности
+// и хранит историю последних запусков
+type Runner struct {
+	cfg    *config.BackupConfig
+	bucket string
+	global chan struct{}   // Общий лимит одновременных бэкапов (nil - без ограничений)
+	limits throttle.Limits // Общие ограничения скорости загрузки и чтения
+	wg     sync.WaitGroup  // Выполняющиеся запуски
+
+	// Ограничения скорости заданий; создаются один раз и действуют на все запуски задания, в том числе параллельные
+	backupLimits map[string]throttle.Limits
+
+	mu     sync.Mutex
+	closed bool                     // Wait вызван, новые запуски не принимаются
+	hosts  map[string]chan struct{} // Лимиты по хостам источников
+	jobs   map[string]*jobState
+	runs   []*run // Последние запуски, от старых к новым
+}
+
+// New создает Runner для указанной конфигурации и бакета
+func New(cfg *config.BackupConfig, bucketName string) *Runner {
+	r := &Runner{
+		cfg:    cfg,
+		bucket: bucketName,
+		hosts:  make(map[string]chan struct{}),
+		jobs:   make(map[string]*jobState),
+		limits: throttle.New(cfg.Throttle),
+
+		backupLimits: make(map[string]throttle.Limits, len(cfg.Backups)),
+	}
+	for _, item := range cfg.Backups {
+		r.backupLimits[item.Name] = throttle.New(item.Throttle)
+	}
+	if cfg.MaxConcurrent > 0 {
+		r.global = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return r
+}
+
+// Run выполняет резервное копирование с соблюдением политики пересечений и лимитов.
+// Отмена ctx прерывает как ожидание свободного слота, так и само резервное копирование.
+// После вызова Wait возвращает ErrClosed, не начиная запуск.
+func (r *Runner) Run(ctx context.Context, item config.ConfigBackup, trigger string) error {
+	if !r.add() {
+		logging.FromContext(ctx).Info("skipping backup: shutting down", "backup", item.Name, "trigger", trigger)
+		return ErrClosed
+	}
+	defer r.wg.Done()
+
+	run, ctx := r.newRun(ctx, item, trigger)
+	return r.execute(ctx, run, item)
+}
+
+// Start запускает резервное копирование в фоне и возвращает идентификатор запуска.
+// После вызова Wait возвращает ErrClosed.
+func (r *Runner) Start(ctx context.Context, item config.ConfigBackup, trigger string) (string, error) {
+	if !r.add() {
+		return "", ErrClosed
+	}
+	run, ctx := r.newRun(ctx, item, trigger)
+	go func() {
+		defer r.wg.Done()
+		_ = r.execute(ctx, run, item)
+	}()
+	return run.info.ID, nil
+}
+
+// add учитывает новый запуск в wg, если Runner еще не остановлен. Проверка и Add выполняются
+// под мьютексом, поэтому Add не может произойти после того, как Wait начал ожидание.
+func (r *Runner) add() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.wg.Add(1)
+	return true
+}
+
+// Cancel отменяет выполняющийся запуск
+func (r *Runner) Cancel(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, run := range r.runs {
+		if run.info.ID != id {
+			continue
+		}
+		if run.info.Status != StatusRunning {
+			return ErrNotRunning
+		}
+		run.cancel()
+		return nil
+	}
+	return fmt.Errorf("run %s not found", id)
+}
+
+// Runs возвращает последние запуски (без логов), от новых к старым
+func (r *Runner) Runs() []RunInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]RunInfo, 0, len(r.runs))
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		runs = append(runs, r.runs[i].info)
+	}
+	return runs
+}
+
+// GetRun возвращает запуск по идентификатору вместе с его логом
+func (r *Runner) GetRun(id string) (RunInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, run := range r.runs {
+		if run.info.ID == id {
+			info := run.info
+			info.Log = run.log.String()
+			return info, true
+		}
+	}
+	return RunInfo{}, false
+}
+
+// LastRun возвращает последний запуск задания
+func (r *Runner) LastRun(name string) (RunInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[name]; ok && job.lastRun != nil {
+		return job.lastRun.info, true
+	}
+	return RunInfo{}, false
+}
+
+// LastSuccess возвращает время последнего успешного запуска задания (нулевое, если его не было)
+func (r *Runner) LastSuccess(name string) time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[name]; ok {
+		return job.success
+	}
+	return time.Time{}
+}
+
+// Running сообщает, выполняется ли сейчас задание
+func (r *Runner) Running(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, run := range r.runs {
+		if run.info.Backup == name && run.info.Status == StatusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// Skipped возвращает количество пропущенных запусков задания
+func (r *Runner) Skipped(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[name]; ok {
+		return job.skipped
+	}
+	return 0
+}
+
+// Wait запрещает новые запуски и блокируется до завершения всех выполняющихся
+func (r *Runner) Wait() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// newRun регистрирует новый запуск и возвращает контекст с возможностью отмены и логгером запуска
+func (r *Runner) newRun(ctx context.Context, item config.ConfigBackup, trigger string) (*run, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &run{
+		info: RunInfo{
+			ID:        newRunID(),
+			Backup:    item.Name,
+			Trigger:   trigger,
+			Status:    StatusRunning,
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	// Лог запуска пишется и в общий вывод, и в буфер запуска
+	handler := logging.Tee(slog.Default().Handler(), slog.NewTextHandler(&run.log, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger := slog.New(handler).With(
+		"run_id", run.info.ID,
+		"backup", item.Name,
+		"type", item.Type,
+		"trigger", trigger,
+	)
+	ctx = logging.WithLogger(ctx, logger)
+
+	job := r.job(item.Name)
+	r.mu.Lock()
+	job.lastRun = run
+	r.runs = append(r.runs, run)
+	if len(r.runs) > maxRuns {
+		r.runs = r.runs[len(r.runs)-maxRuns:]
+	}
+	r.mu.Unlock()
+
+	return run, ctx
+}
+
+// execute выполняет запуск и фиксирует его результат
+func (r *Runner) execute(ctx context.Context, run *run, item config.ConfigBackup) error {
+	defer run.cancel()
+
+	logger := logging.FromContext(ctx)
+	logger.Info("backup started")
+
+	size, err := r.process(ctx, item)
+
+	r.mu.Lock()
+	run.info.FinishedAt = time.Now().UTC()
+	run.info.Size = size
+	switch {
+	case err == nil:
+		run.info.Status = StatusSuccess
+		r.jobs[item.Name].success = run.info.FinishedAt
+	case errors.Is(err, ErrSkipped):
+		run.info.Status = StatusSkipped
+	case errors.Is(ctx.Err(), context.Canceled):
+		run.info.Status = StatusCancelled
+		run.info.Error = err.Error()
+	default:
+		run.info.Status = StatusFailed
+		run.info.Error = err.Error()
+	}
+	info := run.info
+	r.mu.Unlock()
+
+	attrs := []any{"status", info.Status, "duration", info.FinishedAt.Sub(info.StartedAt).String(), "size", info.Size}
+	if err != nil && info.Status != StatusSkipped {
+		logger.Error("backup finished", append(attrs, "error", err)...)
+	} else {
+		logger.Info("backup finished", attrs...)
+	}
+	return err
+}
+
+// process занимает необходимые слоты и выполняет резервное копирование; возвращает размер созданных объектов
+func (r *Runner) process(ctx context.Context, item config.ConfigBackup) (int64, error) {
+	logger := logging.FromContext(ctx)
+	job := r.job(item.Name)
+
+	switch item.Overlap {
+	case config.OverlapAllow:
+		// Параллельные запуски разрешены
+	case config.OverlapQueue:
+		if !acquire(job.lock) {
+			logger.Info("previous run is still in progress, queueing this run")
+			if err := wait(ctx, job.lock); err != nil {
+				return 0, err
+			}
+		}
+		defer release(job.lock)
+	default:
+		if !acquire(job.lock) {
+			r.mu.Lock()
+			job.skipped++
+			skipped := job.skipped
+			r.mu.Unlock()
+			logger.Warn("previous run is still in progress, skipping this run", "skipped_total", skipped)
+			return 0, ErrSkipped
+		}
+		defer release(job.lock)
+	}
+
+	// Лимит по хосту берется раньше общего, чтобы ожидающие задания не занимали общий слот
+	if host := backup.SourceHost(item); host != "" && r.cfg.MaxPerHost > 0 {
+		sem := r.hostSem(host)
+		if !acquire(sem) {
+			logger.Info("waiting for a free slot on source host", "host", host)
+			if err := wait(ctx, sem); err != nil {
+				return 0, err
+			}
+		}
+		defer release(sem)
+	}
+
+	if r.global != nil {
+		if !acquire(r.global) {
+			logger.Info("waiting for a free global slot")
+			if err := wait(ctx, r.global); err != nil {
+				return 0, err
+			}
+		}
+		defer release(r.global)
+	}
+
+	return backup.ProcessBackup(ctx, r.cfg, item, r.bucket, r.limits, r.backupLimits[item.Name])
+}
+
+// job возвращает состояние задания, создавая его при необходимости
+func (r *Runner) job(name string) *jobState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[name]
+	if !ok {
+		job = &jobState{lock: make(chan struct{}, 1)}
+		r.jobs[name] = job
+	}
+	return job
+}
+
+// hostSem возвращает семафор для хоста источника
+func (r *Runner) hostSem(host string) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sem, ok := r.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, r.cfg.MaxPerHost)
+		r.hosts[host] = sem
+	}
+	return sem
+}
+
+// acquire пытается занять слот семафора без ожидания
+func acquire(sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait занимает слот семафора, ожидая его освобождения или отмены контекста
+func wait(ctx context.Context, sem chan struct{}) error {
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release освобождает слот семафора
+func release(sem chan struct{}) {
+	<-sem
+}
+
+// newRunID генерирует случайный идентификатор запуска
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// limitedBuffer накапливает лог запуска, отбрасывая вывод сверх maxRunLog
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if free := maxRunLog - len(b.buf); free < len(p) {
+		b.buf = append(b.buf, p[:max(free, 0)]...)
+		b.truncated = true
+	} else {
+		b.buf = append(b.buf, p...)
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.truncated {
+		return string(b.buf) + "\n... log truncated\n"
+	}
+	return string(b.buf)
+}
@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"backup-to-minio/internal/config"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowItem - задание, которое выполняется около 100 мс (pre-хук) и завершается ошибкой типа
+func slowItem() config.ConfigBackup {
+	return config.ConfigBackup{
+		Name:    "slow",
+		Type:    "unsupported",
+		Overlap: config.OverlapAllow,
+		Hooks: config.Hooks{
+			Pre: []config.Hook{{Command: "sh", Args: []string{"-c", "sleep 0.1"}}},
+		},
+	}
+}
+
+func TestWaitWhileRunsAreStarting(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	r := New(&config.BackupConfig{Project: "test"}, "bucket")
+	item := slowItem()
+
+	// Запуск, который уже выполняется, Wait должен дождаться
+	started, err := r.Start(context.Background(), item, TriggerAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Запуски продолжают поступать, пока идет остановка
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var err error
+				if i%2 == 0 {
+					err = r.Run(context.Background(), item, TriggerSchedule)
+				} else {
+					_, err = r.Start(context.Background(), item, TriggerAPI)
+				}
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				time.Sleep(2 * time.Millisecond)
+			}
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	r.Wait()
+
+	// После Wait не осталось выполняющихся запусков, в том числе принятых во время остановки
+	for _, info := range r.Runs() {
+		if info.Status == StatusRunning {
+			t.Errorf("run %s is still in progress after Wait returned", info.ID)
+		}
+	}
+	if info, ok := r.GetRun(started); !ok || info.Status != StatusFailed {
+		t.Errorf("run started before Wait: %+v", info)
+	}
+
+	if err := r.Run(context.Background(), item, TriggerManual); !errors.Is(err, ErrClosed) {
+		t.Errorf("Run after Wait = %v, want ErrClosed", err)
+	}
+	if _, err := r.Start(context.Background(), item, TriggerAPI); !errors.Is(err, ErrClosed) {
+		t.Errorf("Start after Wait = %v, want ErrClosed", err)
+	}
+
+	close(stop)
+	wg.Wait()
+}
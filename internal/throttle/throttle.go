@@ -0,0 +1,147 @@
+package throttle
+
+import (
+	"backup-to-minio/internal/config"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// window - интервал времени суток с собственным ограничением скорости (в минутах от полуночи)
+type window struct {
+	from, to int
+	limit    int64
+}
+
+// contains проверяет, попадает ли минута суток в интервал (с учетом перехода через полночь)
+func (w window) contains(minute int) bool {
+	if w.from <= w.to {
+		return minute >= w.from && minute < w.to
+	}
+	return minute >= w.from || minute < w.to
+}
+
+// Limiter ограничивает скорость в байтах в секунду с учетом расписания по времени суток
+type Limiter struct {
+	base    int64
+	windows []window
+
+	mu      sync.Mutex
+	current int64 // Действующее ограничение (0 - без ограничений)
+	limiter *rate.Limiter
+}
+
+// newLimiter создает ограничитель; возвращает nil, если ограничений нет
+func newLimiter(base config.ByteRate, schedule []config.ThrottleWindow, pick func(config.ThrottleWindow) config.ByteRate) *Limiter {
+	l := &Limiter{base: int64(base)}
+	limited := base > 0
+	for _, w := range schedule {
+		// Формат проверен при загрузке конфигурации
+		from, _ := time.Parse("15:04", w.From)
+		to, _ := time.Parse("15:04", w.To)
+		l.windows = append(l.windows, window{
+			from:  from.Hour()*60 + from.Minute(),
+			to:    to.Hour()*60 + to.Minute(),
+			limit: int64(pick(w)),
+		})
+		limited = limited || pick(w) > 0
+	}
+	if !limited {
+		return nil
+	}
+	return l
+}
+
+// limitAt возвращает ограничение, действующее в указанный момент
+func (l *Limiter) limitAt(now time.Time) int64 {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range l.windows {
+		if w.contains(minute) {
+			return w.limit
+		}
+	}
+	return l.base
+}
+
+// rateLimiter возвращает ограничитель для текущего времени (nil, если скорость не ограничена)
+func (l *Limiter) rateLimiter() *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limitAt(time.Now())
+	if limit <= 0 {
+		l.current = 0
+		return nil
+	}
+	if l.limiter == nil {
+		l.limiter = rate.NewLimiter(rate.Limit(limit), int(limit))
+	} else if limit != l.current {
+		l.limiter.SetLimit(rate.Limit(limit))
+		l.limiter.SetBurst(int(limit))
+	}
+	l.current = limit
+	return l.limiter
+}
+
+// Limits содержит ограничители загрузки в MinIO и чтения исходных файлов
+type Limits struct {
+	Upload *Limiter
+	Read   *Limiter
+}
+
+// New создает ограничители по настройкам конфигурации
+func New(cfg config.Throttle) Limits {
+	return Limits{
+		Upload: newLimiter(cfg.UploadLimit, cfg.Schedule, func(w config.ThrottleWindow) config.ByteRate { return w.UploadLimit }),
+		Read:   newLimiter(cfg.ReadLimit, cfg.Schedule, func(w config.ThrottleWindow) config.ByteRate { return w.ReadLimit }),
+	}
+}
+
+// reader ограничивает скорость чтения набором ограничителей
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+// Reader оборачивает r так, чтобы чтение не превышало скорость каждого из ограничителей.
+// Ограничители со значением nil пропускаются; если ограничений нет, возвращается r.
+func Reader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	var active []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	if len(active) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiters: active}
+}
+
+func (t *reader) Read(p []byte) (int, error) {
+	// Ограничение по времени суток может меняться, поэтому лимитеры запрашиваются на каждое чтение
+	var limiters []*rate.Limiter
+	for _, l := range t.limiters {
+		if rl := l.rateLimiter(); rl != nil {
+			limiters = append(limiters, rl)
+			// Размер чтения не должен превышать burst, иначе WaitN вернет ошибку
+			if burst := rl.Burst(); len(p) > burst {
+				p = p[:burst]
+			}
+		}
+	}
+
+	n, err := t.r.Read(p)
+	if n > 0 {
+		for _, rl := range limiters {
+			if waitErr := rl.WaitN(t.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}